@@ -22,9 +22,13 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
+// returned by Pages callbacks to stop fetching when opts.MaxItems() is reached
+var errLimitReached = errors.New("result limit reached")
+
 // Account is a Google account. It contains user's email, avatar URL and OAuth2
 // token.
 type Account struct {
@@ -43,9 +47,17 @@ type Account struct {
 	// Calendars contained by account
 	Calendars []*Calendar
 
+	// CalDAV server (nil for Google accounts)
+	CalDAV *CalDAVServer
+
+	// Subscribed feeds (only in the Subscriptions account)
+	Feeds []*Feed
+
 	// OAuth2
 	Token *oauth2.Token
 	auth  *Authenticator
+
+	password string // CalDAV password, read from the Keychain once
 }
 
 // NewAccount creates a new account or loads an existing one.
@@ -95,6 +107,19 @@ func LoadAccounts() ([]*Account, error) {
 	return accounts, nil
 }
 
+// accountForCalendar returns the Account the specified calendar belongs to.
+func accountForCalendar(calendarID string) (*Account, error) {
+	for _, acc := range accounts {
+		for _, c := range acc.Calendars {
+			if c.ID == calendarID {
+				return acc, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no account for calendar %q", calendarID)
+}
+
 // CacheName returns the name of Account's cache file.
 func (a *Account) CacheName() string { return "account-" + a.Name + ".json" }
 
@@ -131,6 +156,23 @@ func (a *Account) Save() error {
 	return nil
 }
 
+// keychainName returns the Keychain account a CalDAV password is saved under.
+func (a *Account) keychainName() string { return "caldav-" + a.Name }
+
+// caldavPassword returns the CalDAV account's password from the Keychain.
+func (a *Account) caldavPassword() string {
+	if a.password != "" {
+		return a.password
+	}
+
+	s, err := wf.Keychain.Get(a.keychainName())
+	if err != nil {
+		log.Printf("[account] ERR: get password for %q: %v", a.Name, err)
+	}
+	a.password = s
+	return s
+}
+
 // Service returns a Calendar Service for this Account.
 func (a *Account) Service() (*calendar.Service, error) {
 	var (
@@ -152,22 +194,49 @@ func (a *Account) Service() (*calendar.Service, error) {
 
 // FetchCalendars retrieves a list of all calendars in Account.
 func (a *Account) FetchCalendars() error {
+	cals, err := a.Provider().Calendars()
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(CalsByTitle(cals))
+	a.Calendars = cals
+	return a.Save()
+}
+
+// fetchGoogleCalendars retrieves the calendars in a Google account.
+func (a *Account) fetchGoogleCalendars() ([]*Calendar, error) {
 	var (
-		srv  *calendar.Service
-		ls   *calendar.CalendarList
-		cals []*Calendar
-		err  error
+		srv     *calendar.Service
+		entries []*calendar.CalendarListEntry
+		cals    []*Calendar
+		err     error
 	)
 
 	if srv, err = a.Service(); err != nil {
-		return errors.Wrap(err, "create service")
+		return nil, errors.Wrap(err, "create service")
 	}
 
-	if ls, err = srv.CalendarList.List().Do(); err != nil {
-		return errors.Wrap(err, "retrieve calendar list")
+	err = srv.CalendarList.List().
+		MaxResults(250).
+		Pages(context.Background(), func(ls *calendar.CalendarList) error {
+			for _, entry := range ls.Items {
+				if len(entries) == opts.MaxItems() {
+					return errLimitReached
+				}
+				entries = append(entries, entry)
+			}
+			return nil
+		})
+
+	if err == errLimitReached {
+		log.Printf("[account] WARN: stopped after %d calendars in %q. Some calendars are missing.",
+			len(entries), a.Name)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "retrieve calendar list")
 	}
 
-	for _, entry := range ls.Items {
+	for _, entry := range entries {
 		if entry.Hidden {
 			log.Printf("[account] ignoring hidden calendar %q in %q", entry.Summary, a.Name)
 			continue
@@ -178,6 +247,7 @@ func (a *Account) FetchCalendars() error {
 			Title:       entry.Summary,
 			Description: entry.Description,
 			Colour:      entry.BackgroundColor,
+			TimeZone:    entry.TimeZone,
 			AccountName: a.Name,
 		}
 		if entry.SummaryOverride != "" {
@@ -186,18 +256,17 @@ func (a *Account) FetchCalendars() error {
 		cals = append(cals, c)
 	}
 
-	sort.Sort(CalsByTitle(cals))
-	a.Calendars = cals
-	return a.Save()
+	return cals, nil
 }
 
-// FetchEvents returns events from the specified calendar.
-func (a *Account) FetchEvents(cal *Calendar, start time.Time) ([]*Event, error) {
+// FetchEvents returns events from the specified calendar between start and end,
+// and a token to retrieve subsequent changes with FetchChanges.
+func (a *Account) FetchEvents(cal *Calendar, start, end time.Time) ([]*Event, string, error) {
 	var (
-		end       = start.Add(opts.ScheduleDuration())
 		events    = []*Event{}
 		startTime = start.Format(time.RFC3339)
 		endTime   = end.Format(time.RFC3339)
+		syncToken string
 		srv       *calendar.Service
 		err       error
 	)
@@ -205,56 +274,272 @@ func (a *Account) FetchEvents(cal *Calendar, start time.Time) ([]*Event, error)
 	log.Printf("[account] account=%q, cal=%q, start=%s, end=%s", a.Name, cal.Title, start, end)
 
 	if srv, err = a.Service(); err != nil {
-		return nil, a.handleAPIError(err)
+		return nil, "", a.handleAPIError(err)
 	}
 
-	evs, err := srv.Events.List(cal.ID).
+	// Not ordered: the API doesn't return a sync token for ordered
+	// lists, so all events are fetched and the limit applied here.
+	err = srv.Events.List(cal.ID).
 		SingleEvents(true).
 		MaxResults(2500).
 		TimeMin(startTime).
 		TimeMax(endTime).
-		OrderBy("startTime").Do()
+		Pages(context.Background(), func(evs *calendar.Events) error {
+			for _, e := range evs.Items {
+				if ev := a.newEvent(cal, e); ev != nil {
+					events = append(events, ev)
+				}
+			}
+			syncToken = evs.NextSyncToken
+			return nil
+		})
 
 	if err != nil {
+		return nil, "", a.handleAPIError(err)
+	}
+
+	sort.Sort(EventsByStart(events))
+
+	if len(events) > opts.MaxItems() {
+		// no sync token, so calendar will be fully synced next time
+		log.Printf("[account] WARN: dropped %d events after the first %d in %q. Some events are missing.",
+			len(events)-opts.MaxItems(), opts.MaxItems(), cal.Title)
+		return events[:opts.MaxItems()], "", nil
+	}
+
+	return events, syncToken, nil
+}
+
+// SearchEvents returns events in the specified calendar between start and end
+// that match query. Google searches titles, descriptions, locations and
+// attendees.
+func (a *Account) SearchEvents(cal *Calendar, query string, start, end time.Time) ([]*Event, error) {
+	var (
+		events = []*Event{}
+		srv    *calendar.Service
+		err    error
+	)
+
+	log.Printf("[account] account=%q, cal=%q, searching for %q ...", a.Name, cal.Title, query)
+
+	if !a.IsGoogle() {
+		return a.searchLocal(cal, query, start, end)
+	}
+
+	if srv, err = a.Service(); err != nil {
 		return nil, a.handleAPIError(err)
 	}
 
-	for _, e := range evs.Items {
-		if e.Start.DateTime == "" { // all-day event
-			continue
+	err = srv.Events.List(cal.ID).
+		Q(query).
+		SingleEvents(true).
+		MaxResults(2500).
+		TimeMin(start.Format(time.RFC3339)).
+		TimeMax(end.Format(time.RFC3339)).
+		Pages(context.Background(), func(evs *calendar.Events) error {
+			for _, e := range evs.Items {
+				if len(events) == opts.MaxItems() {
+					return errLimitReached
+				}
+				if ev := a.newEvent(cal, e); ev != nil {
+					events = append(events, ev)
+				}
+			}
+			return nil
+		})
+
+	if err == errLimitReached {
+		log.Printf("[account] WARN: stopped after %d results in %q", len(events), cal.Title)
+		return events, nil
+	}
+
+	if err != nil {
+		return nil, a.handleAPIError(err)
+	}
+
+	return events, nil
+}
+
+// searchLocal fetches all events between start and end and returns those
+// whose title, description, location or attendees contain query. It is
+// used for providers without full-text search.
+func (a *Account) searchLocal(cal *Calendar, query string, start, end time.Time) ([]*Event, error) {
+	all, err := a.Provider().Events(cal, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events = []*Event{}
+		q      = strings.ToLower(query)
+	)
+
+	for _, e := range all {
+		texts := []string{e.Title, e.Description, e.Location}
+		for _, at := range e.Attendees {
+			texts = append(texts, at.Name, at.Email)
+		}
+		for _, s := range texts {
+			if contains(s, q) {
+				events = append(events, e)
+				break
+			}
 		}
+	}
 
-		var (
-			start time.Time
-			end   time.Time
-			err   error
-		)
+	return events, nil
+}
 
+// FetchChanges returns events in the specified calendar that have changed
+// since syncToken was issued, the IDs of deleted events and a new sync token.
+// It returns errSyncTokenExpired if the calendar must be fully re-synced,
+// which includes when there are too many changes.
+func (a *Account) FetchChanges(cal *Calendar, syncToken string) ([]*Event, []string, string, error) {
+	var (
+		changed = []*Event{}
+		deleted []string
+		next    string
+		srv     *calendar.Service
+		err     error
+	)
+
+	log.Printf("[account] account=%q, cal=%q, fetching changes ...", a.Name, cal.Title)
+
+	if srv, err = a.Service(); err != nil {
+		return nil, nil, "", a.handleAPIError(err)
+	}
+
+	err = srv.Events.List(cal.ID).
+		SingleEvents(true).
+		MaxResults(2500).
+		SyncToken(syncToken).
+		Pages(context.Background(), func(evs *calendar.Events) error {
+			for _, e := range evs.Items {
+				if len(changed)+len(deleted) == opts.MaxItems() {
+					return errLimitReached
+				}
+				if e.Status == "cancelled" {
+					deleted = append(deleted, e.Id)
+					continue
+				}
+				if ev := a.newEvent(cal, e); ev != nil {
+					changed = append(changed, ev)
+				}
+			}
+			next = evs.NextSyncToken
+			return nil
+		})
+
+	if err == errLimitReached {
+		log.Printf("[account] WARN: more than %d changes in %q", opts.MaxItems(), cal.Title)
+		return nil, nil, "", errSyncTokenExpired
+	}
+
+	if err != nil {
+		if e, ok := err.(*googleapi.Error); ok && e.Code == http.StatusGone {
+			return nil, nil, "", errSyncTokenExpired
+		}
+		return nil, nil, "", a.handleAPIError(err)
+	}
+
+	return changed, deleted, next, nil
+}
+
+// newEvent converts an API event to an Event. It returns nil if the
+// event can't be parsed.
+func (a *Account) newEvent(cal *Calendar, e *calendar.Event) *Event {
+	var (
+		start  time.Time
+		end    time.Time
+		allDay bool
+		err    error
+	)
+
+	if e.Start == nil || e.End == nil {
+		log.Printf("[events] ERR: event %q has no start or end", e.Id)
+		return nil
+	}
+
+	if e.Start.DateTime == "" { // all-day event
+		allDay = true
+		if start, err = time.ParseInLocation(timeFormat, e.Start.Date, displayTZ); err != nil {
+			log.Printf("[events] ERR: parse start date (%s): %v", e.Start.Date, err)
+			return nil
+		}
+		if end, err = time.ParseInLocation(timeFormat, e.End.Date, displayTZ); err != nil {
+			log.Printf("[events] ERR: parse end date (%s): %v", e.End.Date, err)
+			return nil
+		}
+	} else {
 		if start, err = time.Parse(time.RFC3339, e.Start.DateTime); err != nil {
 			log.Printf("[events] ERR: parse start time (%s): %v", e.Start.DateTime, err)
-			continue
+			return nil
 		}
 		if end, err = time.Parse(time.RFC3339, e.End.DateTime); err != nil {
 			log.Printf("[events] ERR: parse end time (%s): %v", e.End.DateTime, err)
-			continue
+			return nil
 		}
+	}
 
-		events = append(events, &Event{
-			ID:            e.Id,
-			IcalUID:       e.ICalUID,
-			Title:         e.Summary,
-			Description:   e.Description,
-			URL:           e.HtmlLink,
-			Location:      e.Location,
-			Start:         start,
-			End:           end,
-			Colour:        cal.Colour,
-			CalendarID:    cal.ID,
-			CalendarTitle: cal.Title,
-		})
+	ev := &Event{
+		ID:            e.Id,
+		IcalUID:       e.ICalUID,
+		Title:         e.Summary,
+		Description:   e.Description,
+		URL:           e.HtmlLink,
+		Location:      e.Location,
+		Start:         start,
+		End:           end,
+		AllDay:        allDay,
+		Free:          e.Transparency == "transparent",
+		Recurring:     e.RecurringEventId != "",
+		ConferenceURL: conferenceURL(e),
+		Colour:        cal.Colour,
+		CalendarID:    cal.ID,
+		CalendarTitle: cal.Title,
 	}
 
-	return events, nil
+	// nil Reminders means "use the default"; an empty override list
+	// means the user turned reminders off for this event
+	if e.Reminders != nil && !e.Reminders.UseDefault {
+		ev.Reminders = []time.Duration{}
+		for _, r := range e.Reminders.Overrides {
+			if r.Method == "popup" {
+				ev.Reminders = append(ev.Reminders, time.Duration(r.Minutes)*time.Minute)
+			}
+		}
+	}
+
+	// events in the calendar's own zone needn't specify one
+	if ev.TimeZone = e.Start.TimeZone; ev.TimeZone == "" {
+		ev.TimeZone = cal.TimeZone
+	}
+
+	if e.Organizer != nil {
+		ev.Organizer = &Attendee{
+			Name:      e.Organizer.DisplayName,
+			Email:     e.Organizer.Email,
+			Organizer: true,
+			Self:      e.Organizer.Self,
+		}
+	}
+
+	for _, at := range e.Attendees {
+		att := &Attendee{
+			Name:      at.DisplayName,
+			Email:     at.Email,
+			Response:  at.ResponseStatus,
+			Optional:  at.Optional,
+			Organizer: at.Organizer,
+			Self:      at.Self || (a.Email != "" && at.Email == a.Email),
+		}
+		if att.Self {
+			ev.Response = att.Response
+		}
+		ev.Attendees = append(ev.Attendees, att)
+	}
+
+	return ev
 }
 
 // QuickAdd creates a new event in the passed calendar from Account.
@@ -264,6 +549,10 @@ func (a *Account) QuickAdd(calendarID string, quick string) error {
 		err error
 	)
 
+	if !a.IsGoogle() {
+		return fmt.Errorf("couldn't understand %q: add a date or time", quick)
+	}
+
 	if srv, err = a.Service(); err != nil {
 		return errors.Wrap(err, "create service")
 	}
@@ -275,6 +564,308 @@ func (a *Account) QuickAdd(calendarID string, quick string) error {
 	return err
 }
 
+// CreateEvent adds a new event to the specified calendar.
+func (a *Account) CreateEvent(cal *Calendar, spec *EventSpec) error {
+	var (
+		srv *calendar.Service
+		ev  = &calendar.Event{
+			Summary:  spec.Title,
+			Location: spec.Location,
+			Start:    &calendar.EventDateTime{TimeZone: cal.TimeZone},
+			End:      &calendar.EventDateTime{TimeZone: cal.TimeZone},
+		}
+		err error
+	)
+
+	if !a.IsGoogle() {
+		return a.Provider().CreateEvent(cal, spec)
+	}
+
+	if srv, err = a.Service(); err != nil {
+		return errors.Wrap(err, "create service")
+	}
+
+	if spec.AllDay {
+		ev.Start.Date = spec.Start.Format(timeFormat)
+		ev.End.Date = spec.End.Format(timeFormat)
+	} else {
+		ev.Start.DateTime = spec.Start.Format(time.RFC3339)
+		ev.End.DateTime = spec.End.Format(time.RFC3339)
+	}
+
+	for _, email := range spec.Attendees {
+		ev.Attendees = append(ev.Attendees, &calendar.EventAttendee{Email: email})
+	}
+
+	if spec.Recurrence != "" {
+		// API requires a time zone for recurring events
+		if cal.TimeZone == "" {
+			c, err := srv.Calendars.Get(cal.ID).Do()
+			if err != nil {
+				return errors.Wrap(a.handleAPIError(err), "get calendar time zone")
+			}
+			ev.Start.TimeZone, ev.End.TimeZone = c.TimeZone, c.TimeZone
+		}
+		ev.Recurrence = []string{spec.Recurrence}
+	}
+
+	if len(spec.Reminders) > 0 {
+		ev.Reminders = &calendar.EventReminders{ForceSendFields: []string{"UseDefault"}}
+		for _, d := range spec.Reminders {
+			ev.Reminders.Overrides = append(ev.Reminders.Overrides,
+				&calendar.EventReminder{Method: "popup", Minutes: int64(d.Minutes())})
+		}
+	}
+
+	call := srv.Events.Insert(cal.ID, ev)
+	if len(spec.Attendees) > 0 {
+		// Google doesn't email invitations unless asked to
+		call = call.SendUpdates("all")
+	}
+	if _, err = call.Do(); err != nil {
+		return errors.Wrap(a.handleAPIError(err), "create new event error")
+	}
+
+	log.Printf("[account] created event %q in %q", spec.Title, cal.Title)
+
+	return nil
+}
+
+// PatchEvent updates the non-empty fields of patch in an existing event.
+func (a *Account) PatchEvent(calendarID, eventID string, patch *calendar.Event) error {
+	srv, err := a.Service()
+	if err != nil {
+		return errors.Wrap(err, "create service")
+	}
+
+	if _, err = srv.Events.Patch(calendarID, eventID, patch).Do(); err != nil {
+		return errors.Wrap(a.handleAPIError(err), "update event")
+	}
+
+	return nil
+}
+
+// DeleteEvent removes an event from a calendar and returns the deleted
+// event. If notify is true, guests are sent a cancellation email. Invitations
+// are declined before they are removed.
+func (a *Account) DeleteEvent(calendarID, eventID string, notify bool) (*calendar.Event, error) {
+	var (
+		srv     *calendar.Service
+		ev      *calendar.Event
+		updates = "none"
+		err     error
+	)
+
+	if srv, err = a.Service(); err != nil {
+		return nil, errors.Wrap(err, "create service")
+	}
+
+	if ev, err = srv.Events.Get(calendarID, eventID).Do(); err != nil {
+		return nil, a.handleAPIError(err)
+	}
+
+	if ev.Organizer != nil && !ev.Organizer.Self {
+		for _, at := range ev.Attendees {
+			if (at.Self || at.Email == a.Email) && at.ResponseStatus != "declined" {
+				if err := a.RSVP(calendarID, eventID, "declined"); err != nil {
+					return nil, errors.Wrap(err, "decline invitation")
+				}
+				break
+			}
+		}
+	}
+
+	if notify {
+		updates = "all"
+	}
+
+	if err = srv.Events.Delete(calendarID, eventID).SendUpdates(updates).Do(); err != nil {
+		return nil, errors.Wrap(a.handleAPIError(err), "delete event")
+	}
+
+	log.Printf("[account] deleted %q from %q", ev.Summary, calendarID)
+
+	return ev, nil
+}
+
+// RestoreEvent undeletes an event. Deleted events are only cancelled, so
+// the original is restored, keeping its ID, guests' responses and place in
+// a recurring series. If that fails, a copy of the event is created.
+func (a *Account) RestoreEvent(calendarID string, ev *calendar.Event) error {
+	srv, err := a.Service()
+	if err != nil {
+		return errors.Wrap(err, "create service")
+	}
+
+	patch := &calendar.Event{Status: "confirmed"}
+	if _, err = srv.Events.Patch(calendarID, ev.Id, patch).SendUpdates("none").Do(); err == nil {
+		log.Printf("[account] restored %q in %q", ev.Summary, calendarID)
+
+		// deleting an invitation declined it
+		for _, at := range ev.Attendees {
+			if (at.Self || at.Email == a.Email) && (at.ResponseStatus == "accepted" || at.ResponseStatus == "tentative") {
+				return a.RSVP(calendarID, ev.Id, at.ResponseStatus)
+			}
+		}
+		return nil
+	}
+
+	log.Printf("[account] ERR: restore %q: %v. Creating a copy instead.", ev.Summary, a.handleAPIError(err))
+
+	// Remove server-assigned fields, so event is created anew
+	ev.Id, ev.ICalUID, ev.Etag, ev.HtmlLink = "", "", "", ""
+	ev.Created, ev.Updated, ev.Status = "", "", ""
+	ev.Sequence = 0
+
+	if _, err = srv.Events.Insert(calendarID, ev).Do(); err != nil {
+		return errors.Wrap(a.handleAPIError(err), "restore event")
+	}
+
+	log.Printf("[account] restored %q to %q", ev.Summary, calendarID)
+
+	return nil
+}
+
+// ImportEvent adds the event in VCALENDAR vc to a calendar. The Calendar
+// API's import keeps the event's iCalUID, so importing an event again
+// updates it instead of creating a duplicate.
+func (a *Account) ImportEvent(cal *Calendar, vc *icalComponent) error {
+	srv, err := a.Service()
+	if err != nil {
+		return errors.Wrap(err, "create service")
+	}
+
+	for _, v := range vc.Children("VEVENT") {
+		ev, err := googleEvent(v, cal, a.Email)
+		if err != nil {
+			return errors.Wrapf(err, "event %q", v.Text("SUMMARY"))
+		}
+		if ev == nil { // cancelled
+			continue
+		}
+
+		if _, err = srv.Events.Import(cal.ID, ev).Do(); err != nil {
+			return errors.Wrap(a.handleAPIError(err), "import event")
+		}
+
+		log.Printf("[account] imported %q into %q", ev.Summary, cal.Title)
+	}
+
+	return nil
+}
+
+// RSVP sets the user's response to an event invitation. response is one of
+// "accepted", "declined" or "tentative".
+func (a *Account) RSVP(calendarID, eventID, response string) error {
+	var (
+		srv   *calendar.Service
+		ev    *calendar.Event
+		found bool
+		err   error
+	)
+
+	if !a.IsGoogle() {
+		return errors.New("responding to invitations is only supported for Google accounts")
+	}
+
+	if srv, err = a.Service(); err != nil {
+		return errors.Wrap(err, "create service")
+	}
+
+	if ev, err = srv.Events.Get(calendarID, eventID).Do(); err != nil {
+		return a.handleAPIError(err)
+	}
+
+	for _, at := range ev.Attendees {
+		if at.Self || at.Email == a.Email {
+			at.ResponseStatus = response
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("%s is not invited to event %q", a.Email, ev.Summary)
+	}
+
+	patch := &calendar.Event{Attendees: ev.Attendees}
+	if _, err = srv.Events.Patch(calendarID, eventID, patch).Do(); err != nil {
+		return errors.Wrap(a.handleAPIError(err), "update attendees")
+	}
+
+	log.Printf("[account] %s response to %q is now %q", a.Email, ev.Summary, response)
+
+	return nil
+}
+
+// FreeBusy returns the busy times of the specified calendars (or email
+// addresses) between start and end. Calendars whose availability can't be
+// retrieved are missing from the returned map.
+func (a *Account) FreeBusy(ids []string, start, end time.Time) (map[string][]interval, error) {
+	var (
+		srv  *calendar.Service
+		resp *calendar.FreeBusyResponse
+		busy = map[string][]interval{}
+		err  error
+	)
+
+	// other providers can only see the account's own calendars
+	if !a.IsGoogle() {
+		for _, id := range ids {
+			cal, err := a.calendarByID(id)
+			if err != nil {
+				continue
+			}
+			events, err := a.Provider().Events(cal, start, end)
+			if err != nil {
+				return nil, err
+			}
+			busy[id] = busyIntervals(events)
+		}
+		return busy, nil
+	}
+
+	if srv, err = a.Service(); err != nil {
+		return nil, errors.Wrap(err, "create service")
+	}
+
+	req := &calendar.FreeBusyRequest{
+		TimeMin: start.Format(time.RFC3339),
+		TimeMax: end.Format(time.RFC3339),
+	}
+	for _, id := range ids {
+		req.Items = append(req.Items, &calendar.FreeBusyRequestItem{Id: id})
+	}
+
+	if resp, err = srv.Freebusy.Query(req).Do(); err != nil {
+		return nil, a.handleAPIError(err)
+	}
+
+	for id, cal := range resp.Calendars {
+		if len(cal.Errors) > 0 {
+			log.Printf("[account] WARN: no availability for %q in %q: %s", id, a.Name, cal.Errors[0].Reason)
+			continue
+		}
+
+		ivs := []interval{}
+		for _, p := range cal.Busy {
+			s, err := time.Parse(time.RFC3339, p.Start)
+			if err != nil {
+				log.Printf("[account] ERR: parse busy start (%s): %v", p.Start, err)
+				continue
+			}
+			e, err := time.Parse(time.RFC3339, p.End)
+			if err != nil {
+				log.Printf("[account] ERR: parse busy end (%s): %v", p.End, err)
+				continue
+			}
+			ivs = append(ivs, interval{s, e})
+		}
+		busy[id] = ivs
+	}
+
+	return busy, nil
+}
+
 // Check for OAuth2 error and  remove tokens if they've expired/been revoked.
 func (a *Account) handleAPIError(err error) error {
 	if err2, ok := err.(*url.Error); ok {
@@ -0,0 +1,567 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsApple  = "http://apple.com/ns/ical/"
+
+	icalProdID = "-//deanishe//alfred-gcal//EN"
+)
+
+// CalDAVServer is the server a CalDAV account's calendars are on.
+// The password is stored in the Keychain.
+type CalDAVServer struct {
+	URL      string // Server, principal or calendar home URL
+	Username string
+}
+
+// caldavProvider is a CalDAV server, e.g. Fastmail or Nextcloud.
+type caldavProvider struct {
+	base     *url.URL
+	username string
+	password string
+	account  string // name of Account
+	client   *http.Client
+}
+
+var _ CalendarProvider = (*caldavProvider)(nil)
+
+// newCalDAVProvider creates a CalDAV provider for the server at URL.
+// If client is nil, http.DefaultClient is used.
+func newCalDAVProvider(URL, username, password, account string, client *http.Client) *caldavProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	u, err := url.Parse(URL)
+	if err != nil {
+		log.Printf("[caldav] ERR: parse URL %q: %v", URL, err)
+		u = &url.URL{}
+	}
+
+	return &caldavProvider{
+		base:     u,
+		username: username,
+		password: password,
+		account:  account,
+		client:   client,
+	}
+}
+
+// self returns the user's email address or an empty string.
+func (p *caldavProvider) self() string {
+	if strings.Contains(p.username, "@") {
+		return p.username
+	}
+	return ""
+}
+
+// resolve returns href as an absolute URL.
+func (p *caldavProvider) resolve(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	return p.base.ResolveReference(u).String()
+}
+
+// appleColour converts an Apple calendar colour to CSS. Apple colours
+// may include alpha, e.g. "#FF2968FF".
+func appleColour(s string) string {
+	if s = strings.TrimSpace(s); strings.HasPrefix(s, "#") && len(s) >= 7 {
+		return s[:7]
+	}
+	return ""
+}
+
+// WebDAV multistatus response.
+type davMultistatus struct {
+	Responses []davResponse `xml:"DAV: response"`
+}
+
+type davResponse struct {
+	Href     string        `xml:"DAV: href"`
+	Propstat []davPropstat `xml:"DAV: propstat"`
+}
+
+// Prop returns the properties the server found.
+func (r davResponse) Prop() davProp {
+	for _, ps := range r.Propstat {
+		if strings.Contains(ps.Status, " 200 ") {
+			return ps.Prop
+		}
+	}
+	return davProp{}
+}
+
+type davPropstat struct {
+	Status string  `xml:"DAV: status"`
+	Prop   davProp `xml:"DAV: prop"`
+}
+
+type davHref struct {
+	Href string `xml:"DAV: href"`
+}
+
+type davProp struct {
+	DisplayName  string  `xml:"DAV: displayname"`
+	ETag         string  `xml:"DAV: getetag"`
+	Principal    davHref `xml:"DAV: current-user-principal"`
+	CalendarHome davHref `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set"`
+	ResourceType struct {
+		Calendar *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar"`
+	} `xml:"DAV: resourcetype"`
+	Components struct {
+		Comps []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"urn:ietf:params:xml:ns:caldav comp"`
+	} `xml:"urn:ietf:params:xml:ns:caldav supported-calendar-component-set"`
+	Description  string `xml:"urn:ietf:params:xml:ns:caldav calendar-description"`
+	Colour       string `xml:"http://apple.com/ns/ical/ calendar-color"`
+	CalendarData string `xml:"urn:ietf:params:xml:ns:caldav calendar-data"`
+}
+
+// request sends an HTTP request to the server and returns the response.
+// Responses with an error status are returned as errors.
+func (p *caldavProvider) request(method, URL string, body io.Reader, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, URL, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "create request")
+	}
+
+	req.SetBasicAuth(p.username, p.password)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s", method, URL)
+	}
+
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, URL, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// multistatus sends a PROPFIND or REPORT request with an XML body.
+func (p *caldavProvider) multistatus(method, URL, depth, body string) (*davMultistatus, error) {
+	resp, err := p.request(method, URL, strings.NewReader(xml.Header+body), map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        depth,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	ms := &davMultistatus{}
+	if err := xml.NewDecoder(resp.Body).Decode(ms); err != nil {
+		return nil, errors.Wrapf(err, "parse %s response", method)
+	}
+
+	return ms, nil
+}
+
+// propfind requests props (XML elements) of URL.
+func (p *caldavProvider) propfind(URL, depth, props string) (*davMultistatus, error) {
+	return p.multistatus("PROPFIND", URL, depth, fmt.Sprintf(
+		`<d:propfind xmlns:d="%s" xmlns:c="%s" xmlns:a="%s"><d:prop>%s</d:prop></d:propfind>`,
+		nsDAV, nsCalDAV, nsApple, props))
+}
+
+// calendarHome finds the URL of the user's calendar collections. If the
+// server doesn't support discovery, the configured URL is assumed to be it.
+func (p *caldavProvider) calendarHome() string {
+	var (
+		base = p.base.String()
+		href string
+	)
+
+	if ms, err := p.propfind(base, "0", "<d:current-user-principal/>"); err == nil && len(ms.Responses) > 0 {
+		href = ms.Responses[0].Prop().Principal.Href
+	}
+
+	if href != "" {
+		base = p.resolve(href)
+	}
+
+	if ms, err := p.propfind(base, "0", "<c:calendar-home-set/>"); err == nil && len(ms.Responses) > 0 {
+		if href := ms.Responses[0].Prop().CalendarHome.Href; href != "" {
+			return p.resolve(href)
+		}
+	}
+
+	return base
+}
+
+// Calendars implements CalendarProvider.
+func (p *caldavProvider) Calendars() ([]*Calendar, error) {
+	home := p.calendarHome()
+	log.Printf("[caldav] calendar home of %q is %s", p.account, home)
+
+	ms, err := p.propfind(home, "1", "<d:displayname/><d:resourcetype/><a:calendar-color/>"+
+		"<c:calendar-description/><c:supported-calendar-component-set/>")
+	if err != nil {
+		return nil, errors.Wrap(err, "list calendars")
+	}
+
+	var cals []*Calendar
+	for _, r := range ms.Responses {
+		prop := r.Prop()
+		if prop.ResourceType.Calendar == nil {
+			continue
+		}
+
+		// ignore task lists etc.
+		if comps := prop.Components.Comps; len(comps) > 0 {
+			var events bool
+			for _, c := range comps {
+				if c.Name == "VEVENT" {
+					events = true
+				}
+			}
+			if !events {
+				continue
+			}
+		}
+
+		c := &Calendar{
+			ID:          p.resolve(r.Href),
+			Title:       prop.DisplayName,
+			Description: prop.Description,
+			AccountName: p.account,
+		}
+
+		if c.Title == "" {
+			c.Title = path.Base(strings.TrimSuffix(r.Href, "/"))
+		}
+
+		c.Colour = appleColour(prop.Colour)
+		cals = append(cals, c)
+	}
+
+	return cals, nil
+}
+
+// Events implements CalendarProvider. The server is asked to expand
+// recurring events, but they're expanded locally if it doesn't.
+func (p *caldavProvider) Events(cal *Calendar, start, end time.Time) ([]*Event, error) {
+	var (
+		s = start.UTC().Format(icalUTC)
+		e = end.UTC().Format(icalUTC)
+	)
+
+	ms, err := p.multistatus("REPORT", cal.ID, "1", fmt.Sprintf(`<c:calendar-query xmlns:d="%s" xmlns:c="%s">
+  <d:prop>
+    <d:getetag/>
+    <c:calendar-data><c:expand start="%s" end="%s"/></c:calendar-data>
+  </d:prop>
+  <c:filter>
+    <c:comp-filter name="VCALENDAR">
+      <c:comp-filter name="VEVENT"><c:time-range start="%s" end="%s"/></c:comp-filter>
+    </c:comp-filter>
+  </c:filter>
+</c:calendar-query>`, nsDAV, nsCalDAV, s, e, s, e))
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch events in %q", cal.Title)
+	}
+
+	var events []*Event
+	for _, r := range ms.Responses {
+		data := r.Prop().CalendarData
+		if data == "" {
+			continue
+		}
+
+		root, err := parseICal(strings.NewReader(data))
+		if err != nil {
+			log.Printf("[caldav] ERR: parse %s: %v", r.Href, err)
+			continue
+		}
+		if err := resolveZones(root); err != nil {
+			log.Printf("[caldav] ERR: %s: %v", r.Href, err)
+		}
+
+		// servers that ignore <c:expand> return whole series
+		href := r.Href
+		events = append(events, expandVEvents(root, cal, p.self(), start, end,
+			func(string) string { return href })...)
+	}
+
+	log.Printf("[caldav] %d event(s) in %q", len(events), cal.Title)
+
+	return events, nil
+}
+
+// CreateEvent implements CalendarProvider.
+func (p *caldavProvider) CreateEvent(cal *Calendar, spec *EventSpec) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return errors.Wrap(err, "generate UID")
+	}
+
+	var (
+		uid = fmt.Sprintf("%x", b)
+		v   = &icalComponent{Name: "VEVENT"}
+		vc  = &icalComponent{Name: "VCALENDAR", Components: []*icalComponent{v}}
+	)
+
+	vc.Set("VERSION", "2.0", nil)
+	vc.Set("PRODID", icalProdID, nil)
+
+	v.Set("UID", uid, nil)
+	v.SetTime("DTSTAMP", time.Now(), false)
+	v.SetText("SUMMARY", spec.Title)
+	if spec.Location != "" {
+		v.SetText("LOCATION", spec.Location)
+	}
+	v.SetTime("DTSTART", spec.Start, spec.AllDay)
+	v.SetTime("DTEND", spec.End, spec.AllDay)
+
+	if spec.Recurrence != "" {
+		v.Set("RRULE", strings.TrimPrefix(spec.Recurrence, "RRULE:"), nil)
+	}
+
+	for _, email := range spec.Attendees {
+		p := attendeeProp(&Attendee{Email: email, Response: "needsAction"}, false)
+		p.Params["RSVP"] = "TRUE"
+		v.Props = append(v.Props, p)
+	}
+
+	for _, d := range spec.Reminders {
+		v.Components = append(v.Components, valarm(spec.Title, d))
+	}
+
+	URL := strings.TrimSuffix(cal.ID, "/") + "/" + uid + ".ics"
+	resp, err := p.request("PUT", URL, strings.NewReader(vc.String()), map[string]string{
+		"Content-Type":  "text/calendar; charset=utf-8",
+		"If-None-Match": "*",
+	})
+	if err != nil {
+		return errors.Wrap(err, "create event")
+	}
+	resp.Body.Close()
+
+	log.Printf("[caldav] created event %q in %q", spec.Title, cal.Title)
+
+	return nil
+}
+
+// UpdateEvent implements CalendarProvider. The change is applied to the
+// event as it is on the server. Single occurrences of recurring events
+// can't be changed.
+func (p *caldavProvider) UpdateEvent(cal *Calendar, e *Event, field string) error {
+	if strings.Contains(e.ID, "#") {
+		return errors.New("changing one occurrence of a recurring CalDAV event is not supported")
+	}
+
+	URL := p.resolve(e.ID)
+	root, v, etag, err := p.fetchObject(URL)
+	if err != nil {
+		return err
+	}
+
+	switch field {
+	case "title":
+		v.SetText("SUMMARY", e.Title)
+	case "location":
+		if e.Location != "" {
+			v.SetText("LOCATION", e.Location)
+		} else {
+			v.Remove("LOCATION")
+		}
+	case "start":
+		v.Remove("DURATION")
+		v.SetTime("DTSTART", e.Start, e.AllDay)
+		v.SetTime("DTEND", e.End, e.AllDay)
+	default:
+		return errors.Errorf("unknown event field: %s", field)
+	}
+	v.SetTime("DTSTAMP", time.Now(), false)
+
+	if err := p.saveObject(URL, root, etag); err != nil {
+		return err
+	}
+
+	log.Printf("[caldav] updated %q in %q", e.Title, cal.Title)
+
+	return nil
+}
+
+// DeleteEvent implements CalendarProvider. An occurrence of a recurring
+// event is deleted by adding an EXDATE to the series.
+func (p *caldavProvider) DeleteEvent(cal *Calendar, eventID string) error {
+	if i := strings.Index(eventID, "#"); i > 0 {
+		return p.deleteOccurrence(cal, eventID[:i], eventID[i+1:])
+	}
+
+	resp, err := p.request("DELETE", p.resolve(eventID), nil, nil)
+	if err != nil {
+		return errors.Wrap(err, "delete event")
+	}
+	resp.Body.Close()
+
+	log.Printf("[caldav] deleted %s from %q", eventID, cal.Title)
+
+	return nil
+}
+
+// deleteOccurrence excludes the occurrence with the given key (see
+// occurrenceKey) from the series at href and removes any modified
+// version of it.
+func (p *caldavProvider) deleteOccurrence(cal *Calendar, href, key string) error {
+	URL := p.resolve(href)
+	root, v, etag, err := p.fetchObject(URL)
+	if err != nil {
+		return err
+	}
+
+	start := v.Prop("DTSTART")
+	if start == nil {
+		return fmt.Errorf("no start time in %s", URL)
+	}
+	first, allDay, err := start.Time(displayTZ)
+	if err != nil {
+		return errors.Wrap(err, "parse start time")
+	}
+
+	// EXDATE must have the same type and time zone as DTSTART
+	exdate := &icalProp{Name: "EXDATE", Params: map[string]string{}}
+	if allDay {
+		t, err := time.ParseInLocation(icalDate, key, displayTZ)
+		if err != nil {
+			return errors.Wrap(err, "parse occurrence")
+		}
+		exdate.Params["VALUE"] = "DATE"
+		exdate.Value = t.Format(icalDate)
+	} else {
+		t, err := time.Parse(icalUTC, key)
+		if err != nil {
+			return errors.Wrap(err, "parse occurrence")
+		}
+		if strings.HasSuffix(start.Value, "Z") {
+			exdate.Value = t.Format(icalUTC)
+		} else { // local or floating time
+			exdate.Value = t.In(first.Location()).Format(icalDateTime)
+			if tzid := start.Param("TZID"); tzid != "" {
+				exdate.Params["TZID"] = tzid
+			}
+		}
+	}
+	v.Props = append(v.Props, exdate)
+
+	var comps []*icalComponent
+	for _, c := range root.Components {
+		if c.Name == "VEVENT" && c.Prop("RECURRENCE-ID") != nil && instanceID(href, c) == href+"#"+key {
+			continue
+		}
+		comps = append(comps, c)
+	}
+	root.Components = comps
+	v.SetTime("DTSTAMP", time.Now(), false)
+
+	if err := p.saveObject(URL, root, etag); err != nil {
+		return err
+	}
+
+	log.Printf("[caldav] deleted occurrence %s of %s from %q", key, href, cal.Title)
+
+	return nil
+}
+
+// fetchObject retrieves and parses the calendar object at URL. It returns
+// the object, its master VEVENT and its ETag.
+func (p *caldavProvider) fetchObject(URL string) (root, master *icalComponent, etag string, err error) {
+	resp, err := p.request("GET", URL, nil, nil)
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "fetch event")
+	}
+	defer resp.Body.Close()
+
+	etag = resp.Header.Get("ETag")
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "read event")
+	}
+
+	if root, err = parseICal(bytes.NewReader(data)); err != nil {
+		return nil, nil, "", errors.Wrap(err, "parse event")
+	}
+
+	for _, c := range root.Children("VEVENT") {
+		if c.Prop("RECURRENCE-ID") == nil {
+			return root, c, etag, nil
+		}
+	}
+
+	return nil, nil, "", fmt.Errorf("no event in %s", URL)
+}
+
+// saveObject replaces the calendar object at URL. If etag is set, the
+// object is only saved if it hasn't changed on the server.
+func (p *caldavProvider) saveObject(URL string, root *icalComponent, etag string) error {
+	header := map[string]string{"Content-Type": "text/calendar; charset=utf-8"}
+	if etag != "" {
+		header["If-Match"] = etag
+	}
+
+	resp, err := p.request("PUT", URL, strings.NewReader(root.String()), header)
+	if err != nil {
+		return errors.Wrap(err, "save event")
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// ImportEvent implements CalendarProvider. The event is saved at a URL
+// derived from its UID, so importing it again replaces it.
+func (p *caldavProvider) ImportEvent(cal *Calendar, vc *icalComponent) error {
+	vevents := vc.Children("VEVENT")
+	if len(vevents) == 0 {
+		return errors.New("no event to import")
+	}
+
+	var (
+		uid = vevents[0].Text("UID")
+		URL = fmt.Sprintf("%s/%x.ics", strings.TrimSuffix(cal.ID, "/"), sha1.Sum([]byte(uid)))
+	)
+
+	resp, err := p.request("PUT", URL, strings.NewReader(vc.String()), map[string]string{
+		"Content-Type": "text/calendar; charset=utf-8",
+	})
+	if err != nil {
+		return errors.Wrap(err, "import event")
+	}
+	resp.Body.Close()
+
+	log.Printf("[caldav] imported %q into %q", vevents[0].Text("SUMMARY"), cal.Title)
+
+	return nil
+}
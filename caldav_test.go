@@ -0,0 +1,271 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCalDAV is a minimal in-memory CalDAV server.
+type fakeCalDAV struct {
+	mu      sync.Mutex
+	objects map[string]string // path -> iCalendar data
+	etags   map[string]int
+}
+
+func newFakeCalDAV() *fakeCalDAV {
+	return &fakeCalDAV{
+		objects: map[string]string{
+			"/cal/work/standup.ics": "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+				"BEGIN:VEVENT\r\nUID:standup\r\nSUMMARY:Standup\r\n" +
+				"DTSTART:20190403T090000Z\r\nDTEND:20190403T091500Z\r\nEND:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\nUID:standup\r\nSUMMARY:Standup (moved)\r\n" +
+				"RECURRENCE-ID:20190404T090000Z\r\n" +
+				"DTSTART:20190404T100000Z\r\nDTEND:20190404T101500Z\r\nEND:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+		},
+		etags: map[string]int{},
+	}
+}
+
+func (s *fakeCalDAV) multistatus(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(207)
+	fmt.Fprintf(w, `%s<d:multistatus xmlns:d="DAV:" xmlns:c="%s" xmlns:a="%s">%s</d:multistatus>`,
+		xml.Header, nsCalDAV, nsApple, body)
+}
+
+func davOK(href, props string) string {
+	return fmt.Sprintf(`<d:response><d:href>%s</d:href><d:propstat><d:prop>%s</d:prop>`+
+		`<d:status>HTTP/1.1 200 OK</d:status></d:propstat></d:response>`, href, props)
+}
+
+func (s *fakeCalDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, p, ok := r.BasicAuth(); !ok || u != "alice@example.com" || p != "pw" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	data, _ := ioutil.ReadAll(r.Body)
+	body := string(data)
+
+	switch {
+	case r.Method == "PROPFIND" && strings.Contains(body, "current-user-principal"):
+		s.multistatus(w, davOK(r.URL.Path,
+			"<d:current-user-principal><d:href>/principals/alice/</d:href></d:current-user-principal>"))
+
+	case r.Method == "PROPFIND" && strings.Contains(body, "calendar-home-set"):
+		s.multistatus(w, davOK(r.URL.Path,
+			"<c:calendar-home-set><d:href>/cal/</d:href></c:calendar-home-set>"))
+
+	case r.Method == "PROPFIND" && r.URL.Path == "/cal/":
+		s.multistatus(w, davOK("/cal/", "<d:resourcetype><d:collection/></d:resourcetype>")+
+			davOK("/cal/work/", "<d:displayname>Work</d:displayname>"+
+				"<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>"+
+				"<a:calendar-color>#FF2968FF</a:calendar-color>"+
+				`<c:supported-calendar-component-set><c:comp name="VEVENT"/></c:supported-calendar-component-set>`)+
+			davOK("/cal/tasks/", "<d:displayname>Tasks</d:displayname>"+
+				"<d:resourcetype><d:collection/><c:calendar/></d:resourcetype>"+
+				`<c:supported-calendar-component-set><c:comp name="VTODO"/></c:supported-calendar-component-set>`))
+
+	case r.Method == "REPORT":
+		var out string
+		for p, ics := range s.objects {
+			if strings.HasPrefix(p, r.URL.Path) {
+				var b strings.Builder
+				xml.EscapeText(&b, []byte(ics))
+				out += davOK(p, "<c:calendar-data>"+b.String()+"</c:calendar-data>")
+			}
+		}
+		s.multistatus(w, out)
+
+	case r.Method == "GET":
+		ics, ok := s.objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, s.etags[r.URL.Path]))
+		fmt.Fprint(w, ics)
+
+	case r.Method == "PUT":
+		_, exists := s.objects[r.URL.Path]
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if m := r.Header.Get("If-Match"); m != "" && m != fmt.Sprintf(`"%d"`, s.etags[r.URL.Path]) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		s.objects[r.URL.Path] = body
+		s.etags[r.URL.Path]++
+		w.WriteHeader(http.StatusCreated)
+
+	case r.Method == "DELETE":
+		if _, ok := s.objects[r.URL.Path]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestCalDAVProvider(t *testing.T) {
+	fake := newFakeCalDAV()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	p := newCalDAVProvider(srv.URL+"/", "alice@example.com", "pw", "test", srv.Client())
+
+	cals, err := p.Calendars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cals) != 1 {
+		t.Fatalf("Expected 1 calendar, got %d", len(cals))
+	}
+	cal := cals[0]
+	if cal.Title != "Work" || cal.Colour != "#FF2968" || cal.ID != srv.URL+"/cal/work/" || cal.AccountName != "test" {
+		t.Errorf("Bad calendar: %+v", cal)
+	}
+
+	var (
+		start = time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+		end   = start.AddDate(0, 0, 7)
+	)
+
+	events, err := p.Events(cal, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	sort.Sort(EventsByStart(events))
+	if x := "/cal/work/standup.ics"; events[0].ID != x {
+		t.Errorf("Bad ID. Expected=%q, Got=%q", x, events[0].ID)
+	}
+	if x := "/cal/work/standup.ics#20190404T090000Z"; events[1].ID != x {
+		t.Errorf("Bad ID. Expected=%q, Got=%q", x, events[1].ID)
+	}
+
+	// occurrences can't be edited
+	if err := p.UpdateEvent(cal, events[1], "title"); err == nil {
+		t.Error("Updated single occurrence")
+	}
+
+	// create
+	spec := &EventSpec{
+		Title:     "Lunch",
+		Start:     time.Date(2019, 4, 5, 12, 0, 0, 0, time.UTC),
+		End:       time.Date(2019, 4, 5, 13, 0, 0, 0, time.UTC),
+		Attendees: []string{"bob@example.com"},
+		Reminders: []time.Duration{10 * time.Minute},
+	}
+	if err := p.CreateEvent(cal, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err = p.Events(cal, start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lunch *Event
+	for _, e := range events {
+		if e.Title == "Lunch" {
+			lunch = e
+		}
+	}
+	if lunch == nil {
+		t.Fatal("Created event not found")
+	}
+	if !lunch.Start.Equal(spec.Start) || !lunch.End.Equal(spec.End) {
+		t.Errorf("Bad times: %v – %v", lunch.Start, lunch.End)
+	}
+	if len(lunch.Attendees) != 1 || lunch.Attendees[0].Email != "bob@example.com" {
+		t.Errorf("Bad attendees: %+v", lunch.Attendees)
+	}
+	if len(lunch.Reminders) != 1 || lunch.Reminders[0] != 10*time.Minute {
+		t.Errorf("Bad reminders: %v", lunch.Reminders)
+	}
+
+	// update only changes the given field, even if lunch is out of date
+	stale := *lunch
+	stale.Title = "Long Lunch"
+	stale.Start, stale.End = stale.Start.Add(-time.Hour), stale.End.Add(time.Hour)
+	if err := p.UpdateEvent(cal, &stale, "title"); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := func() *Event {
+		events, err := p.Events(cal, start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range events {
+			if e.ID == lunch.ID {
+				return e
+			}
+		}
+		t.Fatal("Updated event not found")
+		return nil
+	}
+
+	if e := updated(); e.Title != "Long Lunch" || !e.Start.Equal(spec.Start) || !e.End.Equal(spec.End) {
+		t.Errorf("Bad title update: %+v", e)
+	}
+
+	moved := *lunch
+	moved.Start, moved.End = moved.Start.Add(time.Hour), moved.End.Add(time.Hour)
+	if err := p.UpdateEvent(cal, &moved, "start"); err != nil {
+		t.Fatal(err)
+	}
+	if e := updated(); e.Title != "Long Lunch" || !e.Start.Equal(moved.Start) || !e.End.Equal(moved.End) {
+		t.Errorf("Bad move: %+v", e)
+	}
+
+	// deleting an occurrence excludes it from the series
+	if err := p.DeleteEvent(cal, "/cal/work/standup.ics#20190404T090000Z"); err != nil {
+		t.Fatal(err)
+	}
+	if events, err = p.Events(cal, start, end); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		if strings.HasPrefix(e.ID, "/cal/work/standup.ics#") {
+			t.Errorf("Deleted occurrence still exists: %+v", e)
+		}
+	}
+	if !strings.Contains(fake.objects["/cal/work/standup.ics"], "EXDATE:20190404T090000Z") {
+		t.Errorf("No EXDATE in series: %q", fake.objects["/cal/work/standup.ics"])
+	}
+
+	if err := p.DeleteEvent(cal, "/cal/work/standup.ics"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.DeleteEvent(cal, lunch.ID); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("Expected no events on server, found %d", len(fake.objects))
+	}
+}
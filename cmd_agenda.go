@@ -0,0 +1,145 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// doAgenda shows a summary of each day in the week ("w") or month ("m")
+// containing opts.StartTime.
+func doAgenda(unit string) error {
+	cals, err := loadActiveCalendars()
+	if err != nil || cals == nil {
+		return err
+	}
+
+	var (
+		start = startOfPeriod(midnight(opts.StartTime), unit)
+		end   = addUnits(start, 1, unit)
+		title string
+		info  string
+		name  = "Week"
+	)
+
+	if unit == "m" {
+		name = "Month"
+		title = fmt.Sprintf("%s %d", locale.Months[start.Month()-1], start.Year())
+	} else {
+		_, wk := start.ISOWeek()
+		title = fmt.Sprintf("%s – %s", locale.Short(start), locale.Short(end.AddDate(0, 0, -1)))
+		info = fmt.Sprintf("Week %d · ", wk)
+	}
+
+	events, err := loadEvents(start, end, cals...)
+	if err != nil {
+		return errors.Wrap(err, "load events")
+	}
+
+	if opts.Scripting() {
+		return writeEvents(os.Stdout, opts.Format, events)
+	}
+
+	var (
+		byDay = map[string]*Day{}
+		total int
+	)
+
+	for _, d := range groupByDay(events, start, end) {
+		byDay[d.Date.Format(timeFormat)] = d
+		total += len(d.Events)
+	}
+
+	wf.NewItem(title).
+		Subtitle(fmt.Sprintf("%s%d event(s) · %s busy", info, total, busySummary(events, start, end))).
+		Valid(false).
+		Icon(iconCalendars)
+
+	truncatedWarning()
+
+	if total == 0 && wf.IsRunning("update-events") {
+		wf.NewItem("Fetching Events…").
+			Subtitle("Results will refresh shortly").
+			Icon(ReloadIcon()).
+			Valid(false)
+
+		wf.Rerun(0.1)
+	}
+
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		var (
+			key  = day.Format(timeFormat)
+			sub  = "No events"
+			icon = iconDay
+		)
+
+		if d, ok := byDay[key]; ok {
+			var allDay, timed int
+			for _, e := range d.Events {
+				if e.AllDay {
+					allDay++
+				} else {
+					timed++
+				}
+			}
+
+			var parts []string
+			if timed > 0 {
+				parts = append(parts, fmt.Sprintf("%d event(s)", timed))
+			}
+			if allDay > 0 {
+				parts = append(parts, fmt.Sprintf("%d all-day", allDay))
+			}
+			if timed > 0 {
+				parts = append(parts, busySummary(d.Events, day, day.AddDate(0, 0, 1))+" busy")
+			}
+			sub = strings.Join(parts, " · ")
+		}
+
+		if day.Equal(today) {
+			icon = iconCalToday
+		}
+
+		wf.NewItem(locale.Long(day)).
+			Subtitle(sub).
+			Match(locale.Long(day)+" "+key).
+			Arg(key).
+			Valid(true).
+			Icon(icon).
+			Var("action", "date")
+	}
+
+	// Navigation items
+	prev := addUnits(start, -1, unit).Format(timeFormat)
+	wf.NewItem("Previous " + name).
+		Subtitle(prev).
+		Autocomplete(prev).
+		Valid(false).
+		Icon(iconPrevious)
+
+	next := end.Format(timeFormat)
+	wf.NewItem("Next " + name).
+		Subtitle(next).
+		Autocomplete(next).
+		Valid(false).
+		Icon(iconNext)
+
+	wf.SendFeedback()
+	return nil
+}
+
+// busySummary returns the time blocked by events between start and end,
+// e.g. "3 hr 30 min".
+func busySummary(events []*Event, start, end time.Time) string {
+	d := busyDuration(busyIntervals(events), start, end)
+	if d == 0 {
+		return "0 min"
+	}
+	return humanDuration(d)
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+)
+
+// doAddCalDAV adds a CalDAV account. The password is read from STDIN (so
+// it isn't visible in the process list) and saved in the Keychain.
+func doAddCalDAV() error {
+	wf.Configure(aw.TextErrors(true))
+
+	log.Printf("[caldav] adding account %q (%s) ...", opts.Account, opts.URL)
+
+	if u, err := url.Parse(opts.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("invalid server URL: %q", opts.URL)
+	}
+
+	if opts.Account == feedAccountName {
+		return fmt.Errorf("%q is reserved for subscribed feeds", opts.Account)
+	}
+
+	for _, acc := range accounts {
+		if acc.Name == opts.Account && acc.IsGoogle() {
+			return fmt.Errorf("a Google account called %q already exists", opts.Account)
+		}
+	}
+
+	acc := &Account{
+		Name:      opts.Account,
+		ReadWrite: true,
+		CalDAV:    &CalDAVServer{URL: opts.URL, Username: opts.Username},
+	}
+	if strings.Contains(opts.Username, "@") {
+		acc.Email = opts.Username
+	}
+
+	pw, err := readPassword("Password for " + opts.Username + ": ")
+	if err != nil {
+		return errors.Wrap(err, "read password")
+	}
+	if pw == "" {
+		return errors.New("no password")
+	}
+	acc.password = pw
+
+	// check the server works before saving anything
+	cals, err := acc.Provider().Calendars()
+	if err != nil {
+		return errors.Wrap(err, "fetch calendars")
+	}
+	sort.Sort(CalsByTitle(cals))
+	acc.Calendars = cals
+
+	if err := wf.Keychain.Set(acc.keychainName(), pw); err != nil {
+		return errors.Wrap(err, "save password")
+	}
+	if err := acc.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Added %d calendar(s) from %s", len(acc.Calendars), acc.Name)
+	return nil
+}
+
+// readPassword reads a line from STDIN. If STDIN is a terminal, prompt is
+// shown and the password isn't echoed.
+func readPassword(prompt string) (string, error) {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	if fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, prompt)
+		if err := stty("-echo"); err != nil {
+			return "", err
+		}
+		defer func() {
+			if err := stty("echo"); err != nil {
+				log.Printf("[caldav] ERR: restore terminal: %v", err)
+			}
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	s, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(s, "\r\n"), nil
+}
+
+// stty changes the settings of the terminal connected to STDIN.
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
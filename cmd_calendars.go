@@ -13,6 +13,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	aw "github.com/deanishe/awgo"
 	"github.com/pkg/errors"
@@ -69,6 +70,16 @@ func doListCalendars() error {
 		return err
 	}
 
+	if opts.Scripting() {
+		var matched []*Calendar
+		for _, c := range cals {
+			if fuzzyMatch(c.Title, opts.Query) {
+				matched = append(matched, c)
+			}
+		}
+		return writeCalendars(os.Stdout, opts.Format, matched, active)
+	}
+
 	for _, c := range cals {
 		on := active[c.ID]
 		icon := iconCalOff
@@ -114,6 +125,10 @@ func doListWritableCalendars() error {
 	)
 
 	if cals, err = writableCalendars(); err != nil {
+		if opts.Scripting() {
+			return err
+		}
+
 		if err == errNoWritable {
 			wf.NewItem("No Writeable Account(s)").
 				Subtitle("↩ to go to config and re-authenticate account with read-write permission").
@@ -161,14 +176,44 @@ func doListWritableCalendars() error {
 		return err
 	}
 
+	if opts.Scripting() {
+		active := map[string]bool{}
+		for _, c := range cals {
+			active[c.ID] = true
+		}
+		return writeCalendars(os.Stdout, opts.Format, cals, active)
+	}
+
+	var (
+		query   = strings.TrimSpace(opts.Query)
+		spec    *EventSpec
+		specErr error
+	)
+
+	// Preview of parsed event
+	if query != "" {
+		if spec, specErr = parseEventSpec(query, time.Now()); specErr == nil {
+			wf.NewItem(spec.Title).
+				Subtitle(spec.Summary()).
+				Valid(false).
+				Icon(iconDefault)
+		} else {
+			wf.NewItem("Quick Add “" + query + "”").
+				Subtitle("Google will interpret event (" + specErr.Error() + ")").
+				Valid(false).
+				Icon(iconDefault)
+		}
+	}
+
 	for _, c := range cals {
-		query := strings.TrimSpace(opts.Query)
 		sub := c.Description + " / " + c.AccountName
 		if c.Description == "" {
 			sub = c.AccountName
 		}
-		if query != "" {
-			sub = "Create “" + query + "” in " + c.Title
+		if spec != nil {
+			sub = "Create “" + spec.Title + "” in " + c.Title
+		} else if query != "" {
+			sub = "Quick add “" + query + "” in " + c.Title
 		}
 
 		wf.NewItem(c.Title).
@@ -196,7 +241,7 @@ func allCalendars() ([]*Calendar, error) {
 	)
 
 	for _, acc := range accounts {
-		if wf.Cache.Expired(acc.CacheName(), opts.MaxAgeCalendar()) {
+		if wf.Cache.Expired(acc.CacheName(), opts.MaxAgeCalendar()) && !daemonRunning() {
 			expired = true
 		}
 		cals = append(cals, acc.Calendars...)
@@ -280,6 +325,42 @@ func activeCalendars() ([]*Calendar, error) {
 	return cals, nil
 }
 
+// loadActiveCalendars returns the active calendars for a Script Filter.
+// If there are no accounts, or their calendars haven't been fetched yet,
+// it sends feedback telling the user so and returns nil.
+func loadActiveCalendars() ([]*Calendar, error) {
+	if len(accounts) == 0 {
+		wf.NewItem("No Accounts Configured").
+			Subtitle("Action this item to add a Google account").
+			Autocomplete("workflow:login").
+			Icon(aw.IconWarning)
+
+		wf.SendFeedback()
+		return nil, nil
+	}
+
+	cals, err := activeCalendars()
+	if err == errNoCalendars {
+		if !wf.IsRunning("update-calendars") {
+			cmd := exec.Command(os.Args[0], "update", "calendars")
+			if err := wf.RunInBackground("update-calendars", cmd); err != nil {
+				return nil, errors.Wrap(err, "run calendar update")
+			}
+		}
+
+		wf.NewItem("Fetching List of Calendars…").
+			Subtitle("List will reload shortly").
+			Valid(false).
+			Icon(ReloadIcon())
+
+		wf.Rerun(0.1)
+		wf.SendFeedback()
+		return nil, nil
+	}
+
+	return cals, err
+}
+
 func writableCalendars() ([]*Calendar, error) {
 	var (
 		cals      []*Calendar
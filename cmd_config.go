@@ -9,11 +9,11 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
 
 	aw "github.com/deanishe/awgo"
 	"github.com/pkg/errors"
@@ -49,8 +49,16 @@ func doConfig() error {
 	}
 
 	for _, acc := range accounts {
+		sub := "⌥↩ to remove account / ⌘↩ to re-authenticate"
+		switch {
+		case acc.IsFeeds():
+			sub = fmt.Sprintf("%d subscribed feed(s) / ⌥↩ to unsubscribe from all", len(acc.Feeds))
+		case acc.CalDAV != nil:
+			sub = "CalDAV account at " + acc.CalDAV.URL + " / ⌥↩ to remove account"
+		}
+
 		it := wf.NewItem(acc.Name).
-			Subtitle("⌥↩ to remove account / ⌘↩ to re-authenticate").
+			Subtitle(sub).
 			UID(acc.Name).
 			Arg(acc.Name).
 			Valid(false).
@@ -62,11 +70,13 @@ func doConfig() error {
 			Var("action", "logout").
 			Var("account", acc.Name)
 
-		it.NewModifier("cmd").
-			Subtitle("Re-authenticate account with read-write permission").
-			Valid(true).
-			Var("action", "reauth").
-			Var("account", acc.Name)
+		if acc.IsGoogle() {
+			it.NewModifier("cmd").
+				Subtitle("Re-authenticate account with read-write permission").
+				Valid(true).
+				Var("action", "reauth").
+				Var("account", acc.Name)
+		}
 	}
 
 	var (
@@ -92,6 +102,10 @@ func doConfig() error {
 		Var("key", "maps").
 		Var("value", arg)
 
+	if opts.SyncDaemon {
+		daemonItem()
+	}
+
 	if wf.UpdateAvailable() {
 		wf.NewItem("An Update is Available").
 			Subtitle("A newer version of the workflow is available").
@@ -175,8 +189,9 @@ func doToggle() error {
 		return errors.Wrap(err, "save active calendar list")
 	}
 
-	// calendars have changed, so delete cached schedules
-	return clearEvents()
+	// newly-active calendars have no store, so events are
+	// synced on next run
+	return nil
 }
 
 // Re-authenticate specified account.
@@ -221,6 +236,11 @@ func doLogout() error {
 			if err := os.Remove(acc.IconPath()); err != nil && !os.IsNotExist(err) {
 				return errors.Wrap(err, "delete account avatar")
 			}
+			if acc.CalDAV != nil {
+				if err := wf.Keychain.Delete(acc.keychainName()); err != nil {
+					log.Printf("[logout] ERR: delete password: %v", err)
+				}
+			}
 
 			log.Printf("[logout] removed account %q", opts.Account)
 		}
@@ -252,8 +272,9 @@ func doLogout() error {
 		return errors.Wrap(err, "save active calendar list")
 	}
 
-	// delete cached schedules now calendars have changed
-	return clearEvents()
+	// newly-active calendars have no store, so events are
+	// synced on next run
+	return nil
 }
 
 // doClear removes cached calendars and events.
@@ -288,9 +309,9 @@ func clearEvents() error {
 
 	for _, fi := range infos {
 		name := fi.Name()
-		if strings.HasPrefix(name, "events-") && strings.HasSuffix(name, ".json") {
+		if isStoreFile(name) || isUnsyncedFile(name) || isSearchFile(name) || isFreeBusyFile(name) {
 			if err = os.Remove(filepath.Join(wf.CacheDir(), name)); err != nil {
-				return errors.Wrap(err, "delete events cache file")
+				return errors.Wrap(err, "delete event store")
 			}
 
 			log.Printf("[cache] deleted %q", name)
@@ -0,0 +1,191 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+)
+
+const (
+	daemonJob        = "daemon"      // name of background job
+	daemonStatusFile = "daemon.json" // health of sync daemon
+	minBackoff       = time.Minute   // first retry after a failed sync
+	maxBackoff       = time.Hour     // longest wait between retries
+)
+
+// DaemonStatus is the health of the sync daemon. It is saved to the cache
+// after each sync, so other processes can show it.
+type DaemonStatus struct {
+	PID       int       // process ID of daemon
+	Started   time.Time // when daemon was started
+	LastSync  time.Time // last successful sync of events
+	LastError string    // error from last sync, if it failed
+	Failures  int       // number of consecutive failed syncs
+	NextSync  time.Time // when daemon will next sync
+}
+
+// loadDaemonStatus returns the saved status of the sync daemon or nil.
+func loadDaemonStatus() *DaemonStatus {
+	if !wf.Cache.Exists(daemonStatusFile) {
+		return nil
+	}
+
+	st := &DaemonStatus{}
+	if err := wf.Cache.LoadJSON(daemonStatusFile, st); err != nil {
+		log.Printf("[daemon] ERR: load status: %v", err)
+		return nil
+	}
+
+	return st
+}
+
+// daemonRunning returns true if the sync daemon is keeping the cache
+// up to date, so there's no need to start an update.
+func daemonRunning() bool { return opts.SyncDaemon && wf.IsRunning(daemonJob) }
+
+// startDaemon runs the sync daemon in the background if it's enabled
+// and not already running.
+func startDaemon() error {
+	if !opts.SyncDaemon || wf.IsRunning(daemonJob) {
+		return nil
+	}
+
+	cmd := exec.Command(os.Args[0], "daemon")
+	return errors.Wrap(wf.RunInBackground(daemonJob, cmd), "start sync daemon")
+}
+
+// nextBackoff returns how long to wait after n consecutive failures.
+func nextBackoff(n int) time.Duration {
+	d := minBackoff
+	for i := 1; i < n && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// doDaemon keeps calendars and events in sync until killed. Events are
+// synced every EVENT_CACHE_MINS and the list of calendars every three hours.
+// After an error, it retries with exponential backoff.
+func doDaemon() error {
+	wf.Configure(aw.TextErrors(true))
+
+	var (
+		st = &DaemonStatus{PID: os.Getpid(), Started: time.Now()}
+		// force a calendar update on start
+		lastCalendars time.Time
+		sig           = make(chan os.Signal, 1)
+	)
+
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	log.Printf("[daemon] started (pid=%d, interval=%v)", st.PID, opts.MaxAgeEvents())
+
+	for {
+		err := daemonSync(&lastCalendars)
+
+		wait := opts.MaxAgeEvents()
+		if err != nil {
+			st.Failures++
+			st.LastError = err.Error()
+			wait = nextBackoff(st.Failures)
+			log.Printf("[daemon] ERR: sync failed (%d time(s)), retrying in %v: %v", st.Failures, wait, err)
+		} else {
+			st.Failures = 0
+			st.LastError = ""
+			st.LastSync = time.Now()
+		}
+
+		st.NextSync = time.Now().Add(wait)
+		if err := wf.Cache.StoreJSON(daemonStatusFile, st); err != nil {
+			log.Printf("[daemon] ERR: save status: %v", err)
+		}
+
+		select {
+		case s := <-sig:
+			log.Printf("[daemon] received %v, exiting ...", s)
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// daemonSync reloads accounts (which may have been added or removed since
+// the last run) and syncs calendars if they're older than MaxAgeCalendar
+// and events of active calendars.
+func daemonSync(lastCalendars *time.Time) error {
+	var err error
+	if accounts, err = LoadAccounts(); err != nil {
+		return errors.Wrap(err, "load accounts")
+	}
+
+	if len(accounts) == 0 {
+		log.Print("[daemon] no Google accounts configured")
+		return nil
+	}
+
+	if time.Since(*lastCalendars) >= opts.MaxAgeCalendar() {
+		if err := syncCalendars(); err != nil {
+			return errors.Wrap(err, "sync calendars")
+		}
+		*lastCalendars = time.Now()
+	}
+
+	if err := syncEvents(); err != nil && err != errNoActive && err != errNoCalendars {
+		return errors.Wrap(err, "sync events")
+	}
+
+	return nil
+}
+
+// daemonItem adds an item showing the health of the sync daemon.
+func daemonItem() {
+	var (
+		st      = loadDaemonStatus()
+		running = wf.IsRunning(daemonJob)
+		title   = "Background Sync is Running"
+		sub     string
+		icon    = iconUpdateOK
+	)
+
+	if !running {
+		title = "Background Sync is Not Running"
+		sub = "It will start the next time you use the workflow"
+		icon = aw.IconWarning
+	}
+
+	if st != nil {
+		if st.LastSync.IsZero() {
+			sub = "Never synced"
+		} else {
+			sub = fmt.Sprintf("Last synced %s ago", humanDuration(time.Since(st.LastSync)))
+		}
+
+		if st.LastError != "" {
+			sub += fmt.Sprintf(" · %d failed attempt(s): %s", st.Failures, st.LastError)
+			icon = aw.IconWarning
+		}
+
+		if running && st.NextSync.After(time.Now()) {
+			sub += fmt.Sprintf(" · next in %s", humanDuration(time.Until(st.NextSync)))
+		}
+	}
+
+	wf.NewItem(title).
+		Subtitle(sub).
+		UID("daemon").
+		Valid(false).
+		Icon(icon)
+}
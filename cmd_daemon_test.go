@@ -0,0 +1,29 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	tests := []struct {
+		n int
+		x time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour}, // 64 minutes is too long
+		{100, time.Hour},
+	}
+
+	for _, td := range tests {
+		if v := nextBackoff(td.n); v != td.x {
+			t.Errorf("nextBackoff(%d): Expected=%v, Got=%v", td.n, td.x, v)
+		}
+	}
+}
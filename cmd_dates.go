@@ -10,6 +10,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -20,11 +21,35 @@ import (
 
 var (
 	oneDay     = time.Hour * 24
-	oneWeek    = oneDay * 7
 	today      = midnight(time.Now())
 	tomorrow   = midnight(today.AddDate(0, 0, 1))
 	yesterday  = midnight(today.AddDate(0, 0, -1))
-	parseRegex = regexp.MustCompile(`^(\+|-)?(\d+)(d|w)?$`)
+	parseRegex = regexp.MustCompile(`^(\+|-)?(\d+)(d|w|m|y)?$`)
+	countRegex = regexp.MustCompile(`^(in )?(\d+|an?)\b`)
+	shiftRegex = regexp.MustCompile(`^(\+|-)(\d+)(m|h|d|w)$`)
+
+	months = map[string]time.Month{
+		"jan": time.January, "january": time.January,
+		"feb": time.February, "february": time.February,
+		"mar": time.March, "march": time.March,
+		"apr": time.April, "april": time.April,
+		"may": time.May,
+		"jun": time.June, "june": time.June,
+		"jul": time.July, "july": time.July,
+		"aug": time.August, "august": time.August,
+		"sep": time.September, "sept": time.September, "september": time.September,
+		"oct": time.October, "october": time.October,
+		"nov": time.November, "november": time.November,
+		"dec": time.December, "december": time.December,
+	}
+
+	// units of parseDate offsets
+	dateUnits = map[string]string{
+		"d": "d", "day": "d", "days": "d",
+		"w": "w", "week": "w", "weeks": "w",
+		"m": "m", "month": "m", "months": "m",
+		"y": "y", "year": "y", "years": "y",
+	}
 )
 
 // doDates shows a list of dates in Alfred.
@@ -39,13 +64,24 @@ func doDates() error {
 		return nil
 	}
 
-	var parsed bool
+	var (
+		parsed bool
+		query  = strings.ToLower(strings.TrimSpace(opts.DateFormat))
+	)
+
+	if opts.Scripting() {
+		dates := scriptDates(query)
+		if len(dates) == 0 {
+			return fmt.Errorf("invalid date: %q", opts.DateFormat)
+		}
+		return writeDates(os.Stdout, opts.Format, dates)
+	}
 
-	if t, ok := parseDate(opts.DateFormat); ok {
+	if t, ok := parseDate(query); ok {
 		parsed = true
 
 		short := t.Format(timeFormat)
-		long := t.Format(timeFormatLong)
+		long := locale.Long(t)
 
 		wf.NewItem(long).
 			Subtitle(relativeDays(t, false)).
@@ -53,11 +89,28 @@ func doDates() error {
 			Autocomplete(short).
 			Valid(true).
 			Icon(iconDefault)
-	} else {
+	}
+
+	// Complete partially-typed phrases
+	if query != "" {
+		for _, phrase := range dateSuggestions(query) {
+			t, _ := parseDate(phrase)
+			parsed = true
+
+			wf.NewItem(phrase).
+				Subtitle(locale.Long(t) + " · " + relativeDays(t, false)).
+				Arg(t.Format(timeFormat)).
+				Autocomplete(phrase).
+				Valid(true).
+				Icon(iconDefault)
+		}
+	}
+
+	if !parsed {
 		for i := -3; i < 4; i++ {
 			var (
-				t     = midnight(today.Add(oneDay * time.Duration(i)))
-				long  = t.Format(timeFormatLong)
+				t     = midnight(today.AddDate(0, 0, i))
+				long  = locale.Long(t)
 				short = t.Format(timeFormat)
 				icon  = iconDefault
 			)
@@ -68,7 +121,7 @@ func doDates() error {
 
 			wf.NewItem(relativeDays(t, true)).
 				Subtitle(short).
-				Match(long + " " + t.Format("Monday")).
+				Match(long + " " + locale.Weekday(t)).
 				Arg(short).
 				Autocomplete(short).
 				Valid(true).
@@ -80,16 +133,90 @@ func doDates() error {
 		_ = wf.Filter(opts.DateFormat)
 	}
 
-	wf.WarnEmpty("Invalid date", "Format is YYYY-MM-DD, YYYMMDD or [+|-]NN[d|w]")
+	wf.WarnEmpty("Invalid date", "Try YYYY-MM-DD, +2w, next fri, dec 24 or end of month")
 
 	wf.SendFeedback()
 	return nil
 }
 
+// scriptDates returns the date query is parsed as, or the week around
+// today if query is empty.
+func scriptDates(query string) []time.Time {
+	if t, ok := parseDate(query); ok {
+		return []time.Time{t}
+	}
+
+	var dates []time.Time
+	if query == "" {
+		for i := -3; i < 4; i++ {
+			dates = append(dates, midnight(today.AddDate(0, 0, i)))
+		}
+	}
+	return dates
+}
+
+// dateSuggestions returns phrases understood by parseDate that start with
+// (but aren't the same as) query.
+func dateSuggestions(query string) []string {
+	var (
+		phrases     []string
+		suggestions []string
+		days        = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+		periods     = []string{"week", "month", "year"}
+	)
+
+	phrases = append(phrases, "today", "tomorrow", "yesterday")
+	phrases = append(phrases, days...)
+	for _, rel := range []string{"next", "last", "this"} {
+		for _, p := range periods {
+			phrases = append(phrases, rel+" "+p)
+		}
+		for _, d := range days {
+			phrases = append(phrases, rel+" "+d)
+		}
+	}
+	for _, edge := range []string{"start", "end"} {
+		for _, p := range periods {
+			phrases = append(phrases, edge+" of "+p, edge+" of next "+p)
+		}
+	}
+	for m := time.January; m <= time.December; m++ {
+		phrases = append(phrases, strings.ToLower(m.String()))
+	}
+
+	// complete "in 3" or "3 w"
+	if m := countRegex.FindStringSubmatch(query); m != nil {
+		units := []string{"days", "weeks", "months", "years"}
+		if n := m[2]; n == "1" || n == "a" || n == "an" {
+			units = []string{"day", "week", "month", "year"}
+		}
+		for _, p := range units {
+			if m[1] == "" {
+				phrases = append(phrases, m[2]+" "+p+" ago")
+			}
+			phrases = append(phrases, "in "+m[2]+" "+p)
+		}
+	}
+
+	for _, p := range phrases {
+		if len(suggestions) == 8 {
+			break
+		}
+		if p == query || !strings.HasPrefix(p, query) {
+			continue
+		}
+		if _, ok := parseDate(p); ok {
+			suggestions = append(suggestions, p)
+		}
+	}
+
+	return suggestions
+}
+
 // Return midnight in local timezone for given Time.
 func midnight(t time.Time) time.Time {
-	s := t.Local().Format(timeFormat)
-	m, err := time.ParseInLocation(timeFormat, s, time.Local)
+	s := t.In(displayTZ).Format(timeFormat)
+	m, err := time.ParseInLocation(timeFormat, s, displayTZ)
 	if err != nil {
 		panic(err)
 	}
@@ -98,63 +225,355 @@ func midnight(t time.Time) time.Time {
 
 // parse string into Time. Boolean is true if parsing was successful.
 func parseDate(s string) (time.Time, bool) {
-	s = strings.TrimSpace(s)
+	return parseDateFrom(s, today)
+}
+
+// parseDateFrom parses s into a date relative to the day ref. Understood
+// formats are:
+//
+//	YYYY-MM-DD, YYYYMMDD
+//	[+|-]N[d|w|m|y]                   days (default), weeks, months, years
+//	today, tomorrow, yesterday
+//	mon, friday                       next such day
+//	next fri, last tue, this sat
+//	next week, last month, this year  start of the period
+//	in 3 days, 2 weeks ago
+//	dec 24, 24 december, dec 24 2020  closest such date if year is missing
+//	end of month, start of next week, eom, eow, eoy
+//
+// Weeks start on Monday. Dates without a year may be up to a month in the
+// past, so "mar 20" still means this year's in early April. Boolean is
+// true if parsing was successful.
+func parseDateFrom(s string, ref time.Time) (time.Time, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
 	if s == "" {
 		return time.Time{}, false
 	}
 
-	if t, err := time.ParseInLocation(timeFormat, s, time.Local); err == nil {
+	ref = midnight(ref)
+
+	if t, err := time.ParseInLocation(timeFormat, s, displayTZ); err == nil {
 		return t, true
 	}
-	if t, err := time.ParseInLocation("20060102", s, time.Local); err == nil {
+	if t, err := time.ParseInLocation("20060102", s, displayTZ); err == nil {
 		return t, true
 	}
 
-	// Parse custom format [+|-]NN[d|w]
-	var (
-		add   = true
-		delta time.Duration
-		t     time.Time
-		unit  = "d"
-	)
-	m := parseRegex.FindStringSubmatch(s)
-	if m == nil {
-		return time.Time{}, false
+	// Parse custom format [+|-]NN[d|w|m|y]
+	if m := parseRegex.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return time.Time{}, false
+		}
+		if m[1] == "-" {
+			n = -n
+		}
+		unit := m[3]
+		if unit == "" {
+			unit = "d"
+		}
+		return addUnits(ref, n, unit), true
 	}
 
-	// Sign
-	if m[1] == "-" {
-		add = false
+	return parseDateWords(strings.Fields(strings.Replace(s, ",", " ", -1)), ref)
+}
+
+// parseDateWords parses the phrases described in parseDateFrom.
+func parseDateWords(words []string, ref time.Time) (time.Time, bool) {
+	switch len(words) {
+	case 1:
+		w := words[0]
+		switch w {
+		case "today", "tod":
+			return ref, true
+		case "tomorrow", "tmrw", "tom":
+			return ref.AddDate(0, 0, 1), true
+		case "yesterday":
+			return ref.AddDate(0, 0, -1), true
+		case "eow":
+			return endOfPeriod(ref, "w"), true
+		case "eom":
+			return endOfPeriod(ref, "m"), true
+		case "eoy":
+			return endOfPeriod(ref, "y"), true
+		}
+		if wd, ok := weekdays[w]; ok {
+			return nextWeekday(ref, wd), true
+		}
+		if m, ok := months[w]; ok {
+			return upcomingDate(ref, m, 1)
+		}
+
+	case 2:
+		// next fri, last week, this month
+		if t, ok := relativePeriod(words[0], words[1], ref); ok {
+			return t, true
+		}
 	}
-	// Count
-	n, err := strconv.Atoi(m[2])
-	if err != nil {
+
+	// in N units
+	if len(words) == 3 && words[0] == "in" {
+		if n, unit, ok := parseCount(words[1], words[2]); ok {
+			return addUnits(ref, n, unit), true
+		}
+	}
+
+	// N units ago
+	if len(words) == 3 && words[2] == "ago" {
+		if n, unit, ok := parseCount(words[0], words[1]); ok {
+			return addUnits(ref, -n, unit), true
+		}
+	}
+
+	// start/end of <period>
+	if (len(words) == 3 || len(words) == 4) && words[1] == "of" {
+		var (
+			edge   = words[0]
+			period = words[2:]
+			start  time.Time
+			unit   string
+			ok     bool
+		)
+
+		if edge != "start" && edge != "beginning" && edge != "end" {
+			return time.Time{}, false
+		}
+
+		switch len(period) {
+		case 1:
+			start, unit, ok = relativeStart("this", period[0], ref)
+		case 2:
+			start, unit, ok = relativeStart(period[0], period[1], ref)
+		}
+		if !ok {
+			return time.Time{}, false
+		}
+
+		if edge == "end" {
+			return endOfPeriod(start, unit), true
+		}
+		return start, true
+	}
+
+	// dec 24, 24 dec, december 24th 2020
+	if len(words) == 2 || len(words) == 3 {
+		var (
+			m        time.Month
+			day, yr  int
+			mOK, dOK bool
+		)
+
+		if m, mOK = months[words[0]]; mOK {
+			day, dOK = parseDayOfMonth(words[1])
+		} else if m, mOK = months[words[1]]; mOK {
+			day, dOK = parseDayOfMonth(words[0])
+		}
+		if !mOK || !dOK {
+			return time.Time{}, false
+		}
+
+		if len(words) == 2 {
+			return upcomingDate(ref, m, day)
+		}
+
+		yr, err := strconv.Atoi(words[2])
+		if err != nil || yr < 1000 {
+			return time.Time{}, false
+		}
+		if t := time.Date(yr, m, day, 0, 0, 0, 0, displayTZ); t.Month() == m {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// relativePeriod parses "next fri", "last week", "this month" etc.
+func relativePeriod(rel, noun string, ref time.Time) (time.Time, bool) {
+	if wd, ok := weekdays[noun]; ok {
+		switch rel {
+		case "next":
+			return nextWeekday(ref, wd), true
+		case "last":
+			n := (int(ref.Weekday()) - int(wd) + 7) % 7
+			if n == 0 {
+				n = 7
+			}
+			return ref.AddDate(0, 0, -n), true
+		case "this":
+			return ref.AddDate(0, 0, (int(wd)-int(ref.Weekday())+7)%7), true
+		}
 		return time.Time{}, false
 	}
 
-	if n == 0 {
-		return today, true
+	t, _, ok := relativeStart(rel, noun, ref)
+	return t, ok
+}
+
+// relativeStart returns the start of the week, month or year before, after
+// or containing ref, and the unit of the period.
+func relativeStart(rel, noun string, ref time.Time) (time.Time, string, bool) {
+	var n int
+	switch rel {
+	case "next":
+		n = 1
+	case "last":
+		n = -1
+	case "this":
+	default:
+		return time.Time{}, "", false
 	}
 
-	// Optional unit
-	if m[3] != "" {
-		unit = m[3]
+	unit, ok := dateUnits[noun]
+	if !ok || unit == "d" {
+		return time.Time{}, "", false
 	}
 
-	// Calculate date
-	if unit == "d" {
-		delta = oneDay * time.Duration(n)
-	} else {
-		delta = oneWeek * time.Duration(n)
+	return addUnits(startOfPeriod(ref, unit), n, unit), unit, true
+}
+
+// startOfPeriod returns the first day of the week, month or year containing t.
+func startOfPeriod(t time.Time, unit string) time.Time {
+	switch unit {
+	case "w":
+		return t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	case "m":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case "y":
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
 	}
+	return t
+}
 
-	if add {
-		t = today.Add(delta)
-	} else {
-		t = today.Add(-delta)
+// endOfPeriod returns the last day of the week, month or year containing t.
+func endOfPeriod(t time.Time, unit string) time.Time {
+	return addUnits(startOfPeriod(t, unit), 1, unit).AddDate(0, 0, -1)
+}
+
+// addUnits adds n days (d), weeks (w), months (m) or years (y) to t.
+// Adding months clamps to the end of shorter months, so that a month after
+// 31 January is 28/29 February, not the start of March.
+func addUnits(t time.Time, n int, unit string) time.Time {
+	switch unit {
+	case "w":
+		return t.AddDate(0, 0, n*7)
+	case "m", "y":
+		months := n
+		if unit == "y" {
+			months = n * 12
+		}
+		first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+		day := t.Day()
+		if last := first.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+		return first.AddDate(0, 0, day-1)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// parseCount parses "3 days", "a week", "2 months" etc.
+func parseCount(num, noun string) (int, string, bool) {
+	unit, ok := dateUnits[noun]
+	if !ok {
+		return 0, "", false
+	}
+
+	if num == "a" || num == "an" {
+		return 1, unit, true
 	}
 
-	return midnight(t), true
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 {
+		return 0, "", false
+	}
+
+	return n, unit, true
+}
+
+// parseDayOfMonth parses "24", "1st", "22nd" etc.
+func parseDayOfMonth(s string) (int, bool) {
+	for _, suffix := range []string{"st", "nd", "rd", "th"} {
+		s = strings.TrimSuffix(s, suffix)
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 31 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// upcomingDate returns the first date with the given day and month that
+// is no more than a month before ref. The boolean is false if there is no
+// such day, e.g. 30 February.
+func upcomingDate(ref time.Time, m time.Month, day int) (time.Time, bool) {
+	cutoff := ref.AddDate(0, 0, -30)
+
+	for yr := cutoff.Year(); yr <= cutoff.Year()+4; yr++ { // 4 years for 29 February
+		t := time.Date(yr, m, day, 0, 0, 0, 0, ref.Location())
+		if t.Month() == m && !t.Before(cutoff) {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// parseDateTime parses s into a Time relative to ref. In addition to the
+// date formats understood by parseDate, it accepts a time of day ("14:00",
+// "2pm"), a date and time ("tomorrow 14:00") and shifts in minutes, hours,
+// days or weeks ("+30m", "-1h", "+2d"). Boolean is true if parsing was
+// successful.
+func parseDateTime(s string, ref time.Time) (time.Time, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if m := shiftRegex.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return time.Time{}, false
+		}
+		if m[1] == "-" {
+			n = -n
+		}
+
+		switch m[3] {
+		case "m":
+			return ref.Add(time.Duration(n) * time.Minute), true
+		case "h":
+			return ref.Add(time.Duration(n) * time.Hour), true
+		case "d":
+			return ref.AddDate(0, 0, n), true
+		default:
+			return ref.AddDate(0, 0, n*7), true
+		}
+	}
+
+	var (
+		now    = time.Now()
+		fields = strings.Fields(s)
+	)
+
+	switch len(fields) {
+	case 1:
+		if c, ok := parseClock(fields[0]); ok {
+			return c.on(midnight(ref)), true
+		}
+		if d, ok := parseEventDate(fields[0], now); ok {
+			return clock{ref.Hour(), ref.Minute()}.on(d), true
+		}
+	case 2:
+		d, ok := parseEventDate(fields[0], now)
+		if !ok {
+			break
+		}
+		if c, ok := parseClock(fields[1]); ok {
+			return c.on(d), true
+		}
+	}
+
+	return time.Time{}, false
 }
 
 // Return Time as "x day(s) ago" or "in x day(s)"
@@ -168,7 +587,7 @@ func relativeDays(t time.Time, names bool) string {
 	} else if t.After(today) {
 		d = t.Sub(today)
 	} else {
-		return "Today"
+		return locale.Today
 	}
 	days = int(d.Hours() / 24)
 
@@ -176,40 +595,31 @@ func relativeDays(t time.Time, names bool) string {
 	if names {
 		if days == 1 {
 			if t.Before(today) {
-				return "Yesterday"
+				return locale.Yesterday
 			}
-			return "Tomorrow"
+			return locale.Tomorrow
 		}
-		return t.Format("Monday")
+		return locale.Weekday(t)
 	}
 
-	var (
-		format string
-		unit   = "days"
-	)
-
 	// Return in N day(s) or N day(s) ago
-	format = "%d %s ago"
-	if t.After(today) {
-		format = "in %d %s"
-	}
-	if days == 1 {
-		unit = "day"
+	if t.Before(today) {
+		days = -days
 	}
-	return fmt.Sprintf(format, days, unit)
+	return locale.RelativeDays(days)
 }
 
 // relativeDate returns Yesterday, Today, Tomorrow or long date.
 func relativeDate(t time.Time) string {
 	t = midnight(t)
 	if t.Equal(today) {
-		return "Today"
+		return locale.Today
 	}
 	if t.Equal(yesterday) {
-		return "Yesterday"
+		return locale.Yesterday
 	}
 	if t.Equal(tomorrow) {
-		return "Tomorrow"
+		return locale.Tomorrow
 	}
-	return t.Format("Monday, 2 Jan 2006")
+	return locale.Medium(t)
 }
@@ -8,7 +8,10 @@
 
 package main
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 var validFormats = []string{
 	"2017-11-25", // date strings
@@ -21,13 +24,26 @@ var validFormats = []string{
 	"2w", // weeks
 	"+2w",
 	"-2w",
+	"1m", // months
+	"+2m",
+	"-1y", // years
+	"next friday",
+	"mon",
+	"in 3 days",
+	"dec 24",
+	"end of month",
+	"last tuesday",
 }
 
 var invalidFormats = []string{
-	"1m",
 	"2q",
 	"l1d",
 	"*2d",
+	"next",
+	"in 3 lunches",
+	"feb 30",
+	"middle of month",
+	"24 dec 20",
 }
 
 func TestParseDate(t *testing.T) {
@@ -56,3 +72,74 @@ func TestParseDate(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDateFrom(t *testing.T) {
+	// Wednesday
+	ref := time.Date(2019, 4, 3, 0, 0, 0, 0, time.Local)
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		in string
+		x  time.Time
+	}{
+		{"today", ref},
+		{"Tomorrow", date(2019, 4, 4)},
+		{"yesterday", date(2019, 4, 2)},
+		{"2019-12-24", date(2019, 12, 24)},
+		{"+2", date(2019, 4, 5)},
+		{"-1w", date(2019, 3, 27)},
+		{"+2m", date(2019, 6, 3)},
+		{"-1y", date(2018, 4, 3)},
+		// weekdays
+		{"fri", date(2019, 4, 5)},
+		{"wednesday", date(2019, 4, 10)},
+		{"next friday", date(2019, 4, 5)},
+		{"this wed", ref},
+		{"this mon", date(2019, 4, 8)},
+		{"last tuesday", date(2019, 4, 2)},
+		{"last wed", date(2019, 3, 27)},
+		// periods
+		{"next week", date(2019, 4, 8)},
+		{"this week", date(2019, 4, 1)},
+		{"last month", date(2019, 3, 1)},
+		{"next year", date(2020, 1, 1)},
+		{"in 3 days", date(2019, 4, 6)},
+		{"in a week", date(2019, 4, 10)},
+		{"in 2 months", date(2019, 6, 3)},
+		{"3 weeks ago", date(2019, 3, 13)},
+		{"end of month", date(2019, 4, 30)},
+		{"eom", date(2019, 4, 30)},
+		{"end of week", date(2019, 4, 7)},
+		{"end of next month", date(2019, 5, 31)},
+		{"start of next week", date(2019, 4, 8)},
+		{"beginning of year", date(2019, 1, 1)},
+		{"eoy", date(2019, 12, 31)},
+		// month names
+		{"dec 24", date(2019, 12, 24)},
+		{"24 December", date(2019, 12, 24)},
+		{"oct 1", date(2019, 10, 1)},
+		{"march 20th", date(2019, 3, 20)}, // recent past
+		{"feb 1", date(2020, 2, 1)},
+		{"feb 29", date(2020, 2, 29)},
+		{"dec 24, 2020", date(2020, 12, 24)},
+		{"jun", date(2019, 6, 1)},
+		{"mar", date(2020, 3, 1)},
+	}
+
+	for _, td := range tests {
+		v, ok := parseDateFrom(td.in, ref)
+		if !ok {
+			t.Errorf("couldn't parse %q", td.in)
+			continue
+		}
+		if !v.Equal(td.x) {
+			t.Errorf("Bad date for %q. Expected=%s, Got=%s", td.in, td.x.Format(timeFormat), v.Format(timeFormat))
+		}
+	}
+
+	// months are clamped to last day
+	jan31 := date(2019, 1, 31)
+	if v, _ := parseDateFrom("+1m", jan31); !v.Equal(date(2019, 2, 28)) {
+		t.Errorf("Bad date for +1m from 2019-01-31: %s", v.Format(timeFormat))
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	undoFile    = "undo.json"
+	undoTimeout = 15 * time.Minute // how long a deleted event can be restored
+)
+
+// undoRecord is a deleted event that can be restored.
+type undoRecord struct {
+	CalendarID string
+	Deleted    time.Time
+	Event      *calendar.Event
+}
+
+// doDelete deletes an event or asks for confirmation if --confirm isn't set.
+func doDelete() error {
+	if opts.Confirm {
+		return deleteEvent()
+	}
+
+	e, err := cachedEvent(opts.CalendarID, opts.EventID)
+	if err != nil {
+		return err
+	}
+
+	acc, err := accountForCalendar(e.CalendarID)
+	if err != nil {
+		return err
+	}
+
+	// only Google declines invitations and notifies guests
+	var (
+		icon    = ColouredIcon(iconDelete, e.Colour)
+		google  = acc.IsGoogle()
+		invited = google && e.Response != "" && (e.Organizer == nil || !e.Organizer.Self)
+		guests  = google && len(e.Attendees) > 1
+		sub     = eventTimes(e) + " / " + e.CalendarTitle
+	)
+
+	if !google {
+		sub += " / can't be undone"
+	}
+
+	item := func(title, sub string, notify bool) {
+		it := wf.NewItem(title).
+			Subtitle(sub).
+			Valid(true).
+			Icon(icon).
+			Var("action", "remove").
+			Var("event", e.ID).
+			Var("calendar", e.CalendarID)
+
+		if notify {
+			it.Var("notify", "1")
+		}
+	}
+
+	switch {
+	case invited:
+		item("Decline and Remove “"+e.Title+"”", sub, false)
+	case guests:
+		item("Delete “"+e.Title+"” and Notify Guests", "Guests will receive a cancellation email", true)
+		item("Delete “"+e.Title+"” Without Notifying Guests", sub, false)
+	default:
+		item("Delete “"+e.Title+"”", sub, false)
+	}
+
+	wf.NewItem("Cancel").
+		Subtitle("Keep event").
+		Valid(true).
+		Icon(iconPrevious).
+		Var("action", "cancel")
+
+	wf.SendFeedback()
+	return nil
+}
+
+// deleteEvent deletes an event and saves an undo record.
+func deleteEvent() error {
+	wf.Configure(aw.TextErrors(true))
+
+	log.Printf("[delete] event=%q, calendar=%q, notify=%v", opts.EventID, opts.CalendarID, opts.Notify)
+
+	acc, err := accountForCalendar(opts.CalendarID)
+	if err != nil {
+		return err
+	}
+
+	// only Google events can be restored
+	if !acc.IsGoogle() {
+		cal, err := acc.calendarByID(opts.CalendarID)
+		if err != nil {
+			return err
+		}
+		e, err := cachedEvent(opts.CalendarID, opts.EventID)
+		if err != nil {
+			return err
+		}
+		if err := acc.Provider().DeleteEvent(cal, opts.EventID); err != nil {
+			return err
+		}
+		if err := syncCalendar(opts.CalendarID); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted “%s”", e.Title)
+		return nil
+	}
+
+	ev, err := acc.DeleteEvent(opts.CalendarID, opts.EventID, opts.Notify)
+	if err != nil {
+		return err
+	}
+
+	r := undoRecord{CalendarID: opts.CalendarID, Deleted: time.Now(), Event: ev}
+	if err := wf.Cache.StoreJSON(undoFile, r); err != nil {
+		return errors.Wrap(err, "save undo record")
+	}
+
+	if err := removeCachedEvent(opts.CalendarID, opts.EventID); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted “%s”", ev.Summary)
+	return nil
+}
+
+// doUndo restores the last deleted event or asks for confirmation
+// if --confirm isn't set.
+func doUndo() error {
+	r, err := loadUndoRecord()
+	if err != nil {
+		return err
+	}
+
+	if opts.Confirm {
+		wf.Configure(aw.TextErrors(true))
+
+		if r == nil {
+			return errors.New("nothing to undo")
+		}
+
+		acc, err := accountForCalendar(r.CalendarID)
+		if err != nil {
+			return err
+		}
+
+		if err := acc.RestoreEvent(r.CalendarID, r.Event); err != nil {
+			return err
+		}
+
+		if err := wf.Cache.Store(undoFile, nil); err != nil {
+			return errors.Wrap(err, "delete undo record")
+		}
+
+		fmt.Printf("Restored “%s”", r.Event.Summary)
+
+		// restored event may be a copy with a new ID, so fetch it
+		return syncCalendar(r.CalendarID)
+	}
+
+	if r == nil {
+		wf.NewItem("Nothing to Undo").
+			Subtitle(fmt.Sprintf("No events deleted in the last %0.0f minutes", undoTimeout.Minutes())).
+			Icon(aw.IconWarning)
+
+		wf.SendFeedback()
+		return nil
+	}
+
+	wf.NewItem("Restore “"+r.Event.Summary+"”").
+		Subtitle("Deleted "+humanDuration(time.Since(r.Deleted))+" ago").
+		Valid(true).
+		Icon(iconDefault).
+		Var("action", "undo")
+
+	wf.SendFeedback()
+	return nil
+}
+
+// loadUndoRecord returns the last deleted event or nil if there is none
+// or it's too old to restore.
+func loadUndoRecord() (*undoRecord, error) {
+	if wf.Cache.Expired(undoFile, undoTimeout) {
+		return nil, nil
+	}
+
+	r := &undoRecord{}
+	if err := wf.Cache.LoadJSON(undoFile, r); err != nil {
+		return nil, errors.Wrap(err, "load undo record")
+	}
+
+	if r.Event == nil || time.Since(r.Deleted) > undoTimeout {
+		return nil, nil
+	}
+
+	return r, nil
+}
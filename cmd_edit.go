@@ -0,0 +1,209 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+)
+
+// doEdit shows options to change an event's title, location or time.
+func doEdit() error {
+	e, err := cachedEvent(opts.CalendarID, opts.EventID)
+	if err != nil {
+		return err
+	}
+
+	query := strings.TrimSpace(opts.Query)
+	if query == "" {
+		wf.NewItem(e.Title).
+			Subtitle("Type a new title to rename event").
+			Valid(false).
+			Icon(ColouredIcon(iconCalendar, e.Colour))
+
+		loc := e.Location
+		if loc == "" {
+			loc = "No location"
+		}
+		wf.NewItem(loc).
+			Subtitle("Type “at <place>” to change location").
+			Autocomplete("at ").
+			Valid(false).
+			Icon(ColouredIcon(iconMap, e.Colour))
+
+		wf.NewItem(eventTimes(e)).
+			Subtitle("Type +30m, -1h, +1d, 14:00 or tomorrow 14:00 to reschedule").
+			Valid(false).
+			Icon(iconDay)
+
+		wf.SendFeedback()
+		return nil
+	}
+
+	// times and locations aren't new titles
+	rename := true
+
+	if t, ok := parseDateTime(query, e.Start); ok {
+		moveItem(e, t)
+		rename = false
+	} else if strings.HasPrefix(query, "at ") {
+		rename = false
+		loc := strings.TrimSpace(query[3:])
+
+		if t, ok := parseDateTime(loc, e.Start); ok { // "at 14:00"
+			moveItem(e, t)
+		} else {
+			wf.NewItem("Change location to “"+loc+"”").
+				Subtitle("Currently: "+e.Location).
+				Valid(true).
+				Icon(ColouredIcon(iconMap, e.Colour)).
+				Var("action", "patch").
+				Var("event", e.ID).
+				Var("calendar", e.CalendarID).
+				Var("key", "location").
+				Var("value", loc)
+		}
+	}
+
+	if rename {
+		wf.NewItem("Rename to “"+query+"”").
+			Subtitle("Currently: "+e.Title).
+			Valid(true).
+			Icon(ColouredIcon(iconCalendar, e.Colour)).
+			Var("action", "patch").
+			Var("event", e.ID).
+			Var("calendar", e.CalendarID).
+			Var("key", "title").
+			Var("value", query)
+	}
+
+	wf.SendFeedback()
+	return nil
+}
+
+// doMove shows options to reschedule an event.
+func doMove() error {
+	e, err := cachedEvent(opts.CalendarID, opts.EventID)
+	if err != nil {
+		return err
+	}
+
+	if t, ok := parseDateTime(opts.Query, e.Start); ok {
+		moveItem(e, t)
+	} else {
+		wf.NewItem(eventTimes(e)).
+			Subtitle("Type +30m, -1h, +1d, 14:00 or tomorrow 14:00 to reschedule").
+			Valid(false).
+			Icon(iconDay)
+	}
+
+	wf.SendFeedback()
+	return nil
+}
+
+// doPatch changes an event.
+func doPatch() error {
+	wf.Configure(aw.TextErrors(true))
+
+	log.Printf("[patch] event=%q, calendar=%q, %s=%q", opts.EventID, opts.CalendarID, opts.Key, opts.Value)
+
+	acc, err := accountForCalendar(opts.CalendarID)
+	if err != nil {
+		return err
+	}
+
+	cal, err := acc.calendarByID(opts.CalendarID)
+	if err != nil {
+		return err
+	}
+
+	e, err := cachedEvent(opts.CalendarID, opts.EventID)
+	if err != nil {
+		return err
+	}
+
+	switch opts.Key {
+	case "title":
+		e.Title = opts.Value
+
+	case "location":
+		e.Location = opts.Value
+		e.MapURL = mapURL(e.Location)
+
+	case "start":
+		t, err := time.Parse(time.RFC3339, opts.Value)
+		if err != nil {
+			return errors.Wrap(err, "parse start time")
+		}
+		if e.AllDay {
+			// only the date of all-day events can change
+			days := int(e.Duration().Hours()/24 + 0.5)
+			e.Start = midnight(t)
+			e.End = e.Start.AddDate(0, 0, days)
+		} else {
+			e.End = t.Add(e.Duration())
+			e.Start = t
+		}
+
+	default:
+		return fmt.Errorf("unknown event field: %s", opts.Key)
+	}
+
+	if err := acc.Provider().UpdateEvent(cal, e, opts.Key); err != nil {
+		return err
+	}
+
+	if opts.Key == "start" {
+		// fetch moved event (and any changed recurrences)
+		return syncCalendar(opts.CalendarID)
+	}
+
+	return updateCachedEvents(func(ev *Event) bool {
+		if ev.ID != e.ID || ev.CalendarID != e.CalendarID {
+			return false
+		}
+		*ev = *e
+		return true
+	})
+}
+
+// moveItem adds an item to move Event to start.
+func moveItem(e *Event, start time.Time) {
+	moved := *e
+	moved.Start = start
+	moved.End = start.Add(e.Duration())
+	if e.AllDay {
+		moved.Start = midnight(start)
+		moved.End = moved.Start.Add(e.Duration())
+	}
+
+	wf.NewItem("Move to "+eventTimes(&moved)).
+		Subtitle("Currently: "+eventTimes(e)).
+		Valid(true).
+		Icon(iconDay).
+		Var("action", "patch").
+		Var("event", e.ID).
+		Var("calendar", e.CalendarID).
+		Var("key", "start").
+		Var("value", moved.Start.Format(time.RFC3339))
+}
+
+// eventTimes returns Event's date and time, e.g. "Mon 2 Jan, 14:00 – 15:00".
+func eventTimes(e *Event) string {
+	if e.AllDay {
+		s := locale.Short(e.Start)
+		if last := e.LastDay(); last.After(e.Start) {
+			s += " – " + locale.Short(last)
+		}
+		return s + ", all day"
+	}
+
+	return fmt.Sprintf("%s, %s – %s", locale.Short(e.Start.In(displayTZ)),
+		e.Start.In(displayTZ).Format(hourFormat), e.End.In(displayTZ).Format(hourFormat))
+}
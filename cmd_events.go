@@ -13,6 +13,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"sort"
 	"time"
 
 	aw "github.com/deanishe/awgo"
@@ -21,77 +22,66 @@ import (
 
 // doEvents shows a list of events in Alfred.
 func doEvents() error {
-	if len(accounts) == 0 {
-		wf.NewItem("No Accounts Configured").
-			Subtitle("Action this item to add a Google account").
-			Autocomplete("workflow:login").
+	cals, err := loadActiveCalendars()
+	if err == errNoActive {
+		wf.NewItem("No Active Calendars").
+			Subtitle("Action this item to choose calendars").
+			Autocomplete("workflow:calendars").
 			Icon(aw.IconWarning)
 
 		wf.SendFeedback()
+
 		return nil
 	}
-
-	var (
-		cals []*Calendar
-		err  error
-	)
-
-	if cals, err = activeCalendars(); err != nil {
-		if err == errNoActive {
-			wf.NewItem("No Active Calendars").
-				Subtitle("Action this item to choose calendars").
-				Autocomplete("workflow:calendars").
-				Icon(aw.IconWarning)
-
-			wf.SendFeedback()
-
-			return nil
-		}
-
-		if err == errNoCalendars {
-			if !wf.IsRunning("update-calendars") {
-				cmd := exec.Command(os.Args[0], "update", "calendars")
-				if err := wf.RunInBackground("update-calendars", cmd); err != nil {
-					return errors.Wrap(err, "run calendar update")
-				}
-			}
-
-			wf.NewItem("Fetching List of Calendars…").
-				Subtitle("List will reload shortly").
-				Valid(false).
-				Icon(ReloadIcon())
-
-			wf.Rerun(0.1)
-			wf.SendFeedback()
-
-			return nil
-		}
-
+	if err != nil || cals == nil {
 		return err
 	}
 
 	log.Printf("%d active calendar(s)", len(cals))
 
 	var (
-		all    []*Event
 		events []*Event
+		days   []*Day
+		count  int
 		parsed time.Time
+		end    = opts.EndTime
 	)
 
-	if all, err = loadEvents(opts.StartTime, cals...); err != nil {
+	if opts.ScheduleMode {
+		end = opts.StartTime.Add(opts.ScheduleDuration())
+	}
+
+	if events, err = loadEvents(opts.StartTime, end, cals...); err != nil {
 		return errors.Wrap(err, "load events")
 	}
 
-	// Filter out events after cutoff
-	for _, e := range all {
-		if !opts.ScheduleMode && e.Start.After(opts.EndTime) {
-			break
+	// Apply filters like "cal:work" and fuzzy-match the rest of the query
+	filters, query := parseFilters(opts.Query)
+	all := events
+	events = filterEvents(events, filters)
+
+	if opts.Scripting() {
+		var matched []*Event
+		for _, e := range events {
+			if !e.End.After(opts.StartTime) || !e.Start.Before(end) {
+				continue
+			}
+			if fuzzyMatch(e.Title, query) {
+				matched = append(matched, e)
+			}
 		}
-		events = append(events, e)
-		log.Printf("%s", e.Title)
+		return writeEvents(os.Stdout, opts.Format, matched)
 	}
 
-	if len(all) == 0 && wf.IsRunning("update-events") {
+	truncatedWarning()
+
+	// Sort events into days, dropping those after cutoff
+	days = groupByDay(events, opts.StartTime, end)
+	for _, d := range days {
+		count += len(d.Events)
+	}
+
+	if len(events) == 0 && wf.IsRunning("update-events") {
 		wf.NewItem("Fetching Events…").
 			Subtitle("Results will refresh shortly").
 			Icon(ReloadIcon()).
@@ -100,62 +90,28 @@ func doEvents() error {
 		wf.Rerun(0.1)
 	}
 
-	log.Printf("%d event(s) for %s", len(events), opts.StartTime.Format(timeFormat))
+	log.Printf("%d event(s) for %s", count, opts.StartTime.Format(timeFormat))
 
-	if t, ok := parseDate(opts.Query); ok {
+	if t, ok := parseDate(query); ok {
 		parsed = t
 	}
 
-	if len(events) == 0 && opts.Query == "" {
-		wf.NewItem(fmt.Sprintf("No Events on %s", opts.StartTime.Format(timeFormatLong))).
+	if count == 0 && opts.Query == "" {
+		wf.NewItem(fmt.Sprintf("No Events on %s", locale.Long(opts.StartTime))).
 			Icon(ColouredIcon(iconCalendar, yellow))
 	}
 
-	var day time.Time
-
-	for _, e := range events {
-		// Show day indicator if this is the first event of a given day
-		if opts.ScheduleMode && midnight(e.Start).After(day) {
-			day = midnight(e.Start)
-
-			wf.NewItem(day.Format(timeFormatLong)).
-				Arg(day.Format(timeFormat)).
+	for _, d := range days {
+		// Show day indicator before each day's events
+		if opts.ScheduleMode {
+			wf.NewItem(locale.Long(d.Date)).
+				Arg(d.Date.Format(timeFormat)).
 				Valid(true).
 				Icon(iconDay)
 		}
 
-		icon := ColouredIcon(iconCalendar, e.Colour)
-
-		sub := fmt.Sprintf("%s – %s / %s",
-			e.Start.Local().Format(hourFormat),
-			e.End.Local().Format(hourFormat),
-			e.CalendarTitle)
-
-		if e.Location != "" {
-			sub = sub + " / " + e.Location
-		}
-
-		it := wf.NewItem(e.Title).
-			Subtitle(sub).
-			Icon(icon).
-			Arg(e.URL).
-			Quicklook(previewURL(opts.StartTime, e.ID)).
-			Valid(true).
-			Var("action", "open")
-
-		if e.Location != "" {
-			app := "Google Maps"
-			if opts.UseAppleMaps {
-				app = "Apple Maps"
-			}
-
-			icon := ColouredIcon(iconMap, e.Colour)
-			it.NewModifier("cmd").
-				Subtitle("Open in "+app).
-				Arg(mapURL(e.Location)).
-				Valid(true).
-				Icon(icon).
-				Var("CALENDAR_APP", "") // Don't open Maps URLs in CALENDAR_APP
+		for _, e := range d.Events {
+			eventItem(e, d.Date)
 		}
 	}
 
@@ -176,14 +132,16 @@ func doEvents() error {
 			Var("action", "date")
 	}
 
-	if opts.Query != "" {
-		wf.Filter(opts.Query)
+	if query != "" {
+		wf.Filter(query)
 	}
 
+	filterSuggestions(opts.Query, cals, all)
+
 	if !parsed.IsZero() {
 		s := parsed.Format(timeFormat)
 
-		wf.NewItem(parsed.Format(timeFormatLong)).
+		wf.NewItem(locale.Long(parsed)).
 			Subtitle(relativeDays(parsed, false)).
 			Arg(s).
 			Autocomplete(s).
@@ -196,30 +154,208 @@ func doEvents() error {
 	return nil
 }
 
-// loadEvents loads events for given date calendar(s) from cache or server.
-func loadEvents(t time.Time, cal ...*Calendar) ([]*Event, error) {
+// eventItem adds an Alfred item for Event shown on given day.
+func eventItem(e *Event, day time.Time) *aw.Item {
+	var (
+		icon = ColouredIcon(iconCalendar, e.Colour)
+		sub  string
+	)
+
+	if e.AllDay {
+		sub = "All day"
+		if days := e.Days(); len(days) > 1 {
+			for i, t := range days {
+				if t.Equal(day) {
+					sub = fmt.Sprintf("All day (day %d of %d)", i+1, len(days))
+					break
+				}
+			}
+		}
+	} else {
+		sub = fmt.Sprintf("%s – %s%s",
+			e.Start.In(displayTZ).Format(hourFormat),
+			e.End.In(displayTZ).Format(hourFormat),
+			otherZoneTimes(e))
+	}
+
+	sub = sub + " / " + e.CalendarTitle
+	if e.Location != "" {
+		sub = sub + " / " + e.Location
+	}
+	if s := e.Status(); s != "" {
+		sub = sub + " / " + s
+	}
+
+	it := wf.NewItem(e.Title).
+		Subtitle(sub).
+		Icon(icon).
+		Arg(e.URL).
+		Quicklook(previewURL(e.Start, e.ID)).
+		Valid(true).
+		Var("action", "open")
+
+	if e.Location != "" {
+		app := "Google Maps"
+		if opts.UseAppleMaps {
+			app = "Apple Maps"
+		}
+
+		icon := ColouredIcon(iconMap, e.Colour)
+		it.NewModifier("cmd").
+			Subtitle("Open in "+app).
+			Arg(mapURL(e.Location)).
+			Valid(true).
+			Icon(icon).
+			Var("CALENDAR_APP", "") // Don't open Maps URLs in CALENDAR_APP
+	}
+
+	if e.ConferenceURL != "" {
+		it.NewModifier("alt").
+			Subtitle("Join video conference").
+			Arg(e.ConferenceURL).
+			Valid(true).
+			Icon(ColouredIcon(iconURL, e.Colour))
+	}
+
+	del := "Delete event"
+	if e.Response != "" && (e.Organizer == nil || !e.Organizer.Self) {
+		del = "Decline and remove invitation"
+	}
+	it.NewModifier(aw.ModFn).
+		Subtitle(del).
+		Valid(true).
+		Var("action", "delete").
+		Var("event", e.ID).
+		Var("calendar", e.CalendarID)
+
+	it.NewModifier(aw.ModCmd, aw.ModOpt).
+		Subtitle("Edit event").
+		Valid(true).
+		Var("action", "edit").
+		Var("event", e.ID).
+		Var("calendar", e.CalendarID)
+
+	it.NewModifier(aw.ModCmd, aw.ModShift).
+		Subtitle("Reschedule event").
+		Valid(true).
+		Var("action", "move").
+		Var("event", e.ID).
+		Var("calendar", e.CalendarID)
+
+	it.NewModifier(aw.ModOpt, aw.ModShift).
+		Subtitle("Save event as .ics file").
+		Valid(true).
+		Var("action", "export").
+		Var("event", e.ID).
+		Var("calendar", e.CalendarID)
+
+	// Respond to invitations
+	if e.Response != "" && (e.Organizer == nil || !e.Organizer.Self) {
+		for _, r := range []struct {
+			keys     []aw.ModKey
+			response string
+			action   string
+		}{
+			{[]aw.ModKey{aw.ModCtrl}, "yes", "Accept"},
+			{[]aw.ModKey{aw.ModCtrl, aw.ModOpt}, "maybe", "Tentatively accept"},
+			{[]aw.ModKey{aw.ModCtrl, aw.ModShift}, "no", "Decline"},
+		} {
+			it.NewModifier(r.keys...).
+				Subtitle(r.action+" invitation").
+				Valid(true).
+				Var("action", "rsvp").
+				Var("event", e.ID).
+				Var("calendar", e.CalendarID).
+				Var("response", r.response)
+		}
+	}
+
+	return it
+}
+
+// truncated contains the IDs of calendars loadEvents found to have more
+// events than MAX_RESULTS allows.
+var truncated = map[string]bool{}
+
+// truncatedWarning adds a warning item if events are missing because
+// calendars have too many events.
+func truncatedWarning() {
+	if len(truncated) == 0 {
+		return
+	}
+
+	wf.NewItem("Some Events Are Missing").
+		Subtitle(fmt.Sprintf("%d calendar(s) have more than %d events. Increase MAX_RESULTS to see them.",
+			len(truncated), opts.MaxItems())).
+		Valid(false).
+		Icon(aw.IconWarning)
+}
+
+// loadEvents loads events for given period and calendar(s) from cache.
+// If the cached events are out of date, an update is started in the
+// background.
+func loadEvents(start, end time.Time, cal ...*Calendar) ([]*Event, error) {
 	var (
 		events  = []*Event{}
-		dateStr = t.Format(timeFormat)
-		name    = fmt.Sprintf("events-%s.json", dateStr)
 		jobName = "update-events"
+		stale   bool
 	)
 
-	if wf.Cache.Expired(name, opts.MaxAgeEvents()) {
+	for _, c := range cal {
+		// the daemon will update the store unless it's never been synced
+		if wf.Cache.Expired(storeName(c.ID), opts.MaxAgeEvents()) &&
+			(!daemonRunning() || !wf.Cache.Exists(storeName(c.ID))) {
+			// scripts can't wait for a background update
+			if opts.Scripting() {
+				if err := syncCalendar(c.ID); err != nil {
+					return nil, errors.Wrapf(err, "sync calendar %q", c.Title)
+				}
+			} else {
+				stale = true
+			}
+		}
+
+		s, err := LoadStore(c.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Period is outside synced window, so fetch it from the server
+		if !s.Start.IsZero() && (start.Before(s.Start) || end.After(s.End)) {
+			log.Printf("[events] %s – %s outside synced window of %q",
+				start.Format(timeFormat), end.Format(timeFormat), c.Title)
+
+			evs, err := unsyncedEvents(c, start, end)
+			if err != nil {
+				return nil, errors.Wrapf(err, "fetch events from %q", c.Title)
+			}
+			events = append(events, evs...)
+			continue
+		}
+
+		if s.Truncated && !truncated[c.ID] {
+			truncated[c.ID] = true
+			log.Printf("[events] WARN: %q has more than %d events", c.Title, opts.MaxItems())
+			if opts.Scripting() {
+				fmt.Fprintf(os.Stderr, "warning: %q has more than %d events, some are missing (see MAX_RESULTS)\n",
+					c.Title, opts.MaxItems())
+			}
+		}
+
+		events = append(events, s.Between(start, end)...)
+	}
+
+	if stale {
 		wf.Rerun(0.1)
 		if !wf.IsRunning(jobName) {
-			cmd := exec.Command(os.Args[0], "update", "events", dateStr)
+			cmd := exec.Command(os.Args[0], "update", "events")
 			if err := wf.RunInBackground(jobName, cmd); err != nil {
 				return nil, err
 			}
 		}
 	}
 
-	if wf.Cache.Exists(name) {
-		if err := wf.Cache.LoadJSON(name, &events); err != nil {
-			return nil, err
-		}
-	}
+	sort.Sort(EventsByStart(events))
 
 	// Set map URL
 	for _, e := range events {
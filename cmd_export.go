@@ -0,0 +1,180 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+)
+
+// doExport writes events from the cache as iCalendar (or in one of the
+// scripting formats). With a calendar and event ID, the event is saved to
+// ~/Downloads and revealed in Finder.
+func doExport() error {
+	wf.Configure(aw.TextErrors(true))
+
+	if opts.EventID != "" {
+		return exportEvent(opts.CalendarID, opts.EventID)
+	}
+
+	if opts.Format == formatAlfred {
+		return fmt.Errorf("unsupported export format: %q", opts.Format)
+	}
+
+	start, end, err := exportRange()
+	if err != nil {
+		return err
+	}
+
+	cals, err := exportCalendars()
+	if err != nil {
+		return err
+	}
+
+	events, err := loadEvents(start, end, cals...)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[export] %d event(s) from %d calendar(s) between %s and %s",
+		len(events), len(cals), start.Format(timeFormat), end.Format(timeFormat))
+
+	var buf bytes.Buffer
+	if opts.Format == "" || opts.Format == "ics" {
+		buf.WriteString(exportICal(events, time.Now()).String())
+	} else if err := writeEvents(&buf, opts.Format, events); err != nil {
+		return err
+	}
+
+	if opts.Output == "" || opts.Output == "-" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	return errors.Wrap(ioutil.WriteFile(opts.Output, buf.Bytes(), 0644), "write export")
+}
+
+// exportRange returns the period given by --from and --to. The default is
+// from today for SCHEDULE_DAYS days.
+func exportRange() (start, end time.Time, err error) {
+	var ok bool
+
+	start = today
+	if opts.From != "" {
+		if start, ok = parseDate(opts.From); !ok {
+			return start, end, fmt.Errorf("invalid date: %q", opts.From)
+		}
+	}
+
+	end = start.Add(opts.ScheduleDuration())
+	if opts.To != "" {
+		if end, ok = parseDate(opts.To); !ok {
+			return start, end, fmt.Errorf("invalid date: %q", opts.To)
+		}
+		// --to is the last day
+		end = midnight(end.AddDate(0, 0, 1))
+	}
+
+	if !end.After(start) {
+		end = start.AddDate(0, 0, 1)
+	}
+
+	return start, end, nil
+}
+
+// exportCalendars returns the calendars given by --calendar (title or ID)
+// or the active calendars.
+func exportCalendars() ([]*Calendar, error) {
+	if len(opts.CalendarNames) == 0 {
+		return activeCalendars()
+	}
+
+	all, err := allCalendars()
+	if err != nil {
+		return nil, err
+	}
+
+	var cals []*Calendar
+	for _, name := range opts.CalendarNames {
+		var found bool
+		for _, c := range all {
+			if c.ID == name || strings.EqualFold(c.Title, name) {
+				cals = append(cals, c)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown calendar: %q", name)
+		}
+	}
+
+	return cals, nil
+}
+
+// exportEvent saves a single event to an .ics file in ~/Downloads and
+// reveals it in Finder.
+func exportEvent(calendarID, eventID string) error {
+	e, err := cachedEvent(calendarID, eventID)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(os.Getenv("HOME"), "Downloads")
+	if _, err := os.Stat(dir); err != nil {
+		dir = os.TempDir()
+	}
+
+	path := uniquePath(filepath.Join(dir, fileName(e.Title)+".ics"))
+	if err := ioutil.WriteFile(path, []byte(exportICal([]*Event{e}, time.Now()).String()), 0644); err != nil {
+		return errors.Wrap(err, "write event")
+	}
+	log.Printf("[export] saved %q to %s", e.Title, path)
+
+	if err := exec.Command("/usr/bin/open", "-R", path).Run(); err != nil {
+		return errors.Wrap(err, "reveal file")
+	}
+
+	fmt.Printf("Saved “%s” to %s", e.Title, filepath.Base(path))
+	return nil
+}
+
+// fileName replaces characters that aren't allowed in filenames.
+func fileName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:`, r) || r < ' ' {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(s))
+
+	if s == "" || s[0] == '.' {
+		s = "event" + s
+	}
+	return s
+}
+
+// uniquePath returns path, or path with a number added if it already exists.
+func uniquePath(path string) string {
+	var (
+		ext  = filepath.Ext(path)
+		base = strings.TrimSuffix(path, ext)
+	)
+
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s %d%s", base, i, ext)
+	}
+}
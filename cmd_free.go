@@ -0,0 +1,164 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSlotDuration = 30 * time.Minute
+	slotRounding        = 15 * time.Minute
+)
+
+// doFree shows free slots in active calendars during working hours.
+func doFree() error {
+	cals, err := loadActiveCalendars()
+	if err != nil || cals == nil {
+		return err
+	}
+
+	dur := defaultSlotDuration
+	if opts.Duration != "" {
+		d, ok := parseDuration(opts.Duration)
+		if !ok && opts.Date == "" {
+			// only a date was given, e.g. "gcal free tomorrow"
+			if t, ok2 := parseEventDate(strings.ToLower(opts.Duration), time.Now()); ok2 {
+				opts.StartTime, opts.ScheduleMode = t, false
+				d, ok = defaultSlotDuration, true
+			}
+		}
+		if !ok {
+			wf.NewItem("Invalid Duration").
+				Subtitle(fmt.Sprintf("Couldn't understand “%s”. Try e.g. 30m or 1h", opts.Duration)).
+				Valid(false).
+				Icon(aw.IconWarning)
+
+			wf.SendFeedback()
+			return nil
+		}
+		dur = d
+	}
+
+	var (
+		days       = freeDays()
+		start, end = days[0], days[len(days)-1].AddDate(0, 0, 1)
+	)
+
+	events, err := loadEvents(start, end, cals...)
+	if err != nil {
+		return errors.Wrap(err, "load events")
+	}
+
+	if slotItems(days, busyIntervals(events), dur, nil) == 0 {
+		if wf.IsRunning("update-events") {
+			wf.NewItem("Fetching Events…").
+				Subtitle("Results will refresh shortly").
+				Icon(ReloadIcon()).
+				Valid(false)
+
+			wf.Rerun(0.1)
+		} else {
+			noSlotsItem(days, dur)
+		}
+	}
+
+	wf.SendFeedback()
+	return nil
+}
+
+// slotItems adds an item for each free period of at least dur within
+// working hours on the given days. Actioning an item opens the create flow
+// with the slot's time and the attendees pre-filled. It returns the number
+// of slots found.
+func slotItems(days []time.Time, busy []interval, dur time.Duration, attendees []string) int {
+	var (
+		now    = time.Now()
+		ws, we = opts.WorkHours()
+		count  int
+	)
+
+	for _, day := range days {
+		from, to := ws.on(day), we.on(day)
+		if from.Before(now) {
+			from = now.Truncate(slotRounding).Add(slotRounding)
+		}
+
+		for _, iv := range freeIntervals(busy, from, to, dur) {
+			var (
+				// pre-filled query for the create flow
+				query = fmt.Sprintf("%s %s for %dm ", iv.Start.Format(timeFormat),
+					iv.Start.Format("15:04"), int(dur.Minutes()))
+				title = fmt.Sprintf("%s – %s", iv.Start.Format(hourFormat), iv.End.Format(hourFormat))
+				sub   = fmt.Sprintf("%s · %s free · ↩ to create %s event",
+					relativeDate(iv.Start), humanDuration(iv.Duration()), humanDuration(dur))
+			)
+
+			if len(attendees) > 0 {
+				query += "with " + strings.Join(attendees, ", ") + " "
+			}
+
+			wf.NewItem(title).
+				Subtitle(sub).
+				Arg(query).
+				Valid(true).
+				Icon(iconCalendar).
+				Var("action", "new")
+
+			count++
+		}
+	}
+
+	return count
+}
+
+// noSlotsItem adds a warning that no free slots were found.
+func noSlotsItem(days []time.Time, dur time.Duration) {
+	var (
+		ws, we = opts.WorkHours()
+		when   = relativeDate(days[0])
+	)
+
+	if len(days) > 1 {
+		when = fmt.Sprintf("Next %d weekdays", len(days))
+	}
+
+	wf.NewItem(fmt.Sprintf("No Free %s Slots", humanDuration(dur))).
+		Subtitle(fmt.Sprintf("%s · working hours %s – %s",
+			when, ws.on(days[0]).Format(hourFormat), we.on(days[0]).Format(hourFormat))).
+		Valid(false).
+		Icon(aw.IconWarning)
+}
+
+// freeDays returns the days to search for free slots. If the user specified
+// a date, only that day is returned, otherwise the next SCHEDULE_DAYS weekdays.
+func freeDays() []time.Time {
+	if !opts.ScheduleMode {
+		return []time.Time{midnight(opts.StartTime)}
+	}
+
+	var (
+		days []time.Time
+		day  = midnight(opts.StartTime)
+		n    = opts.ScheduleDays
+	)
+
+	if n < 1 {
+		n = 1
+	}
+
+	for len(days) < n {
+		if wd := day.Weekday(); wd != time.Saturday && wd != time.Sunday {
+			days = append(days, day)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return days
+}
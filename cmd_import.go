@@ -0,0 +1,233 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+)
+
+// importEvent is an event in an iCalendar file being imported.
+type importEvent struct {
+	*Event
+	occurrences []*Event // occurrences in the preview window
+}
+
+// doImport shows the events in an iCalendar file and the calendars they
+// can be imported into. With --confirm, the events are imported.
+func doImport() error {
+	if opts.Confirm {
+		return importFile(opts.File, opts.CalendarID)
+	}
+
+	events, err := loadImport(opts.File)
+	if err != nil {
+		return err
+	}
+
+	if len(events) == 0 {
+		wf.NewItem("No Events in File").
+			Subtitle(filepath.Base(opts.File)).
+			Icon(aw.IconWarning)
+		wf.SendFeedback()
+		return nil
+	}
+
+	cals, err := writableCalendars()
+	if err != nil {
+		if err == errNoWritable {
+			wf.NewItem("No Writeable Account(s)").
+				Subtitle("↩ to go to config and re-authenticate account with read-write permission").
+				Valid(true).
+				Icon(aw.IconWarning).
+				Var("action", "config")
+
+			wf.SendFeedback()
+			return nil
+		}
+		return err
+	}
+
+	existing, err := importExisting(events)
+	if err != nil {
+		return err
+	}
+
+	// events already in a calendar are updated if imported into it again
+	updated := map[string]map[string]bool{}
+	for _, e2 := range existing {
+		for _, e := range events {
+			if e.IcalUID != "" && e2.IcalUID == e.IcalUID {
+				if updated[e2.CalendarID] == nil {
+					updated[e2.CalendarID] = map[string]bool{}
+				}
+				updated[e2.CalendarID][e.IcalUID] = true
+			}
+		}
+	}
+
+	for _, c := range cals {
+		sub := fmt.Sprintf("%d event(s) from %s", len(events), filepath.Base(opts.File))
+		if n := len(updated[c.ID]); n > 0 {
+			sub += fmt.Sprintf(" / %d already in this calendar, will be updated", n)
+		}
+
+		wf.NewItem("Import into "+c.Title).
+			Subtitle(sub).
+			Icon(ColouredIcon(iconCalendar, c.Colour)).
+			Arg(c.ID).
+			UID(c.ID).
+			Valid(true).
+			Var("action", "import").
+			Var("file", opts.File).
+			Var("calendar", c.ID)
+	}
+
+	for _, e := range events {
+		var (
+			sub   = eventTimes(e.Event)
+			icon  = iconDefault
+			clash []string
+			seen  = map[string]bool{}
+		)
+
+		if len(e.occurrences) > 1 {
+			sub += " (repeats)"
+		}
+
+		for _, o := range e.occurrences {
+			for _, e2 := range conflicts(o, existing) {
+				if !seen[e2.Title] {
+					seen[e2.Title] = true
+					clash = append(clash, "“"+e2.Title+"”")
+				}
+			}
+		}
+
+		for _, e2 := range existing {
+			if e.IcalUID != "" && e2.IcalUID == e.IcalUID {
+				sub += " / already in " + e2.CalendarTitle
+				break
+			}
+		}
+
+		if len(clash) > 0 {
+			sub += " / ⚠ conflicts with " + strings.Join(clash, ", ")
+			icon = aw.IconWarning
+		}
+
+		wf.NewItem(e.Title).
+			Subtitle(sub).
+			Valid(false).
+			Icon(icon)
+	}
+
+	wf.SendFeedback()
+	return nil
+}
+
+// loadImport reads the events in an iCalendar file. Recurring events are
+// expanded for SEARCH_DAYS days from their first occurrence.
+func loadImport(path string) ([]*importEvent, error) {
+	root, err := loadICalFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events []*importEvent
+		cal    = &Calendar{ID: "import"}
+	)
+	for _, vc := range splitEvents(root) {
+		e, err := eventFromVEvent(vc.Children("VEVENT")[0], cal, "")
+		if err != nil {
+			return nil, err
+		}
+		if e == nil { // cancelled
+			continue
+		}
+
+		end := e.Start.AddDate(0, 0, opts.SearchRange())
+		occurrences := expandVEvents(vc, cal, "", e.Start, end, func(uid string) string { return uid })
+		if len(occurrences) == 0 {
+			occurrences = []*Event{e}
+		}
+
+		events = append(events, &importEvent{Event: e, occurrences: occurrences})
+	}
+
+	log.Printf("[import] %d event(s) in %s", len(events), path)
+	return events, nil
+}
+
+// importExisting returns cached events from active calendars in the period
+// covered by events.
+func importExisting(events []*importEvent) ([]*Event, error) {
+	var start, end time.Time
+	for _, e := range events {
+		for _, o := range e.occurrences {
+			if start.IsZero() || o.Start.Before(start) {
+				start = o.Start
+			}
+			if o.End.After(end) {
+				end = o.End
+			}
+		}
+	}
+
+	cals, err := activeCalendars()
+	if err != nil {
+		return nil, err
+	}
+
+	return loadEvents(start, end, cals...)
+}
+
+// importFile imports the events in an iCalendar file into a calendar.
+func importFile(path, calendarID string) error {
+	wf.Configure(aw.TextErrors(true))
+
+	acc, err := accountForCalendar(calendarID)
+	if err != nil {
+		return err
+	}
+	cal, err := acc.calendarByID(calendarID)
+	if err != nil {
+		return err
+	}
+
+	root, err := loadICalFile(path)
+	if err != nil {
+		return err
+	}
+
+	var (
+		p = acc.Provider()
+		n int
+	)
+	for _, vc := range splitEvents(root) {
+		// the preview doesn't show cancelled events either
+		if cancelled(vc.Children("VEVENT")[0]) {
+			continue
+		}
+		if err := p.ImportEvent(cal, vc); err != nil {
+			return errors.Wrap(err, "import event")
+		}
+		n++
+	}
+	log.Printf("[import] imported %d event(s) from %s into %q", n, path, cal.Title)
+
+	if err := syncCalendar(cal.ID); err != nil {
+		return errors.Wrap(err, "sync calendar")
+	}
+
+	fmt.Printf("Imported %d event(s) into “%s”", n, cal.Title)
+	return nil
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+)
+
+const (
+	// How long free/busy information is cached for. Alfred re-runs doMeet
+	// for every keystroke.
+	maxAgeFreeBusy = 2 * time.Minute
+	// Name of background free/busy job.
+	meetJob = "meet"
+)
+
+// emailRegexp matches complete email addresses, so free/busy isn't queried
+// for addresses that are still being typed.
+var emailRegexp = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[a-z]{2,}$`)
+
+// doMeet shows times when attendees and active calendars are all free.
+// Arguments may be email addresses, a duration and a date in any order.
+func doMeet() error {
+	cals, err := loadActiveCalendars()
+	if err != nil || cals == nil {
+		return err
+	}
+
+	emails, dur := parseMeetArgs(opts.Attendees)
+	if len(emails) == 0 {
+		wf.NewItem("Who Are You Meeting?").
+			Subtitle("Enter attendees' email addresses, and optionally a duration and date").
+			Valid(false).
+			Icon(iconDefault)
+
+		wf.SendFeedback()
+		return nil
+	}
+
+	var (
+		days       = freeDays()
+		start, end = days[0], days[len(days)-1].AddDate(0, 0, 1)
+		queries    = freeBusyQueries(cals, emails, start, end)
+		busy       []interval
+		known      = map[string]bool{}
+		stale      bool
+	)
+
+	for _, q := range queries {
+		if wf.Cache.Expired(q.name, maxAgeFreeBusy) {
+			stale = true
+		}
+	}
+
+	// Query free/busy in the background, so Alfred isn't blocked while the
+	// user is typing. If an earlier query is still running, wait for it to
+	// finish before starting a new one.
+	if stale {
+		// show why the last query failed, then try again next time
+		if errName := freeBusyErrorName(emails); wf.Cache.Exists(errName) && !wf.IsRunning(meetJob) {
+			data, err := wf.Cache.Load(errName)
+			if err != nil {
+				return err
+			}
+			if err := wf.Cache.Store(errName, nil); err != nil {
+				return err
+			}
+			return errors.New(string(data))
+		}
+
+		if !wf.IsRunning(meetJob) {
+			cmd := exec.Command(os.Args[0], append([]string{"update", "meet", "--"}, opts.Attendees...)...)
+			if err := wf.RunInBackground(meetJob, cmd); err != nil {
+				return errors.Wrap(err, "run free/busy query")
+			}
+		}
+
+		wf.NewItem("Checking Availability…").
+			Subtitle("Free times will appear shortly").
+			Valid(false).
+			Icon(ReloadIcon())
+
+		wf.Rerun(0.2)
+		wf.SendFeedback()
+		return nil
+	}
+
+	// Attendees are considered known if any account can see their calendar.
+	for _, q := range queries {
+		var m map[string][]interval
+		if err := wf.Cache.LoadJSON(q.name, &m); err != nil {
+			return errors.Wrap(err, "load free/busy")
+		}
+
+		for id, ivs := range m {
+			busy = append(busy, ivs...)
+			known[strings.ToLower(id)] = true
+		}
+	}
+
+	for _, email := range emails {
+		if !known[email] {
+			wf.NewItem("Availability Unknown for " + email).
+				Subtitle("Their calendar isn't shared with you, so they may be busy").
+				Valid(false).
+				Icon(aw.IconWarning)
+		}
+	}
+
+	if slotItems(days, busy, dur, emails) == 0 {
+		noSlotsItem(days, dur)
+	}
+
+	wf.SendFeedback()
+	return nil
+}
+
+// doUpdateMeet queries free/busy information for doMeet and caches it.
+func doUpdateMeet() error {
+	wf.Configure(aw.TextErrors(true))
+
+	cals, err := activeCalendars()
+	if err != nil {
+		return err
+	}
+
+	var (
+		emails, _  = parseMeetArgs(opts.Attendees)
+		days       = freeDays()
+		start, end = days[0], days[len(days)-1].AddDate(0, 0, 1)
+	)
+
+	for _, q := range freeBusyQueries(cals, emails, start, end) {
+		busy, err := q.acc.FreeBusy(q.ids, start, end)
+		if err != nil {
+			err = errors.Wrap(err, "query free/busy")
+			// let doMeet show the error
+			if err2 := wf.Cache.Store(freeBusyErrorName(emails), []byte(err.Error())); err2 != nil {
+				log.Printf("[meet] ERR: save error: %v", err2)
+			}
+			return err
+		}
+
+		if err := wf.Cache.StoreJSON(q.name, busy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseMeetArgs returns the email addresses and duration in doMeet's
+// arguments. A date argument sets opts.StartTime.
+func parseMeetArgs(args []string) (emails []string, dur time.Duration) {
+	dur = defaultSlotDuration
+
+	for _, arg := range args {
+		arg = strings.Trim(arg, ",;")
+		if s := strings.ToLower(arg); emailRegexp.MatchString(s) {
+			emails = append(emails, s)
+			continue
+		}
+		if d, ok := parseDuration(arg); ok {
+			dur = d
+			continue
+		}
+		if t, ok := parseEventDate(strings.ToLower(arg), time.Now()); ok {
+			opts.StartTime, opts.ScheduleMode = t, false
+			continue
+		}
+		log.Printf("[meet] ignored argument: %q", arg)
+	}
+
+	return emails, dur
+}
+
+// freeBusyQuery is the free/busy information needed from one account.
+type freeBusyQuery struct {
+	acc  *Account
+	ids  []string // active calendars and attendees
+	name string   // cache filename
+}
+
+// freeBusyQueries returns a query for each account with active calendars,
+// which covers its own calendars and all attendees.
+func freeBusyQueries(cals []*Calendar, emails []string, start, end time.Time) []freeBusyQuery {
+	var queries []freeBusyQuery
+	for _, acc := range accounts {
+		var ids []string
+		for _, c := range cals {
+			if c.AccountName == acc.Name {
+				ids = append(ids, c.ID)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		ids = append(ids, emails...)
+
+		sorted := append([]string{}, ids...)
+		sort.Strings(sorted)
+		key := fmt.Sprintf("%s|%s|%s|%s", acc.Name, strings.Join(sorted, ","),
+			start.Format(time.RFC3339), end.Format(time.RFC3339))
+
+		queries = append(queries, freeBusyQuery{acc, ids, freeBusyName(key)})
+	}
+	return queries
+}
+
+// freeBusyName returns the cache filename for free/busy information.
+func freeBusyName(key string) string {
+	return fmt.Sprintf("freebusy-%x.json", sha1.Sum([]byte(key)))
+}
+
+// freeBusyErrorName returns the cache filename for the error a background
+// free/busy query for emails failed with.
+func freeBusyErrorName(emails []string) string {
+	return fmt.Sprintf("freebusy-%x.err", sha1.Sum([]byte(strings.Join(emails, ","))))
+}
+
+// isFreeBusyFile returns true if name is the filename of cached free/busy
+// information.
+func isFreeBusyFile(name string) bool {
+	return strings.HasPrefix(name, "freebusy-") && strings.HasSuffix(name, ".json")
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// doNext shows the next (or current) event.
+func doNext() error {
+	cals, err := loadActiveCalendars()
+	if err != nil || cals == nil {
+		return err
+	}
+
+	// Keep countdown current. loadEvents overrides this if
+	// events are being fetched.
+	wf.Rerun(5)
+
+	now := time.Now()
+	events, err := loadEvents(now, now.Add(opts.ScheduleDuration()), cals...)
+	if err != nil {
+		return errors.Wrap(err, "load events")
+	}
+
+	e := nextEvent(events, now)
+
+	if opts.Scripting() {
+		var next []*Event
+		if e != nil {
+			next = append(next, e)
+		}
+		return writeEvents(os.Stdout, opts.Format, next)
+	}
+
+	if e == nil {
+		if wf.IsRunning("update-events") {
+			wf.NewItem("Fetching Events…").
+				Subtitle("Results will refresh shortly").
+				Icon(ReloadIcon()).
+				Valid(false)
+
+			wf.Rerun(0.1)
+		} else {
+			wf.NewItem("No Upcoming Events").
+				Subtitle(fmt.Sprintf("Nothing in the next %d days", opts.ScheduleDays)).
+				Icon(ColouredIcon(iconCalendar, yellow))
+		}
+
+		wf.SendFeedback()
+		return nil
+	}
+
+	var sub string
+	if e.Start.After(now) {
+		sub = "starts in " + humanDuration(e.Start.Sub(now))
+		if midnight(e.Start).After(today) {
+			sub = fmt.Sprintf("%s (%s at %s)", sub, relativeDate(e.Start), e.Start.In(displayTZ).Format(hourFormat))
+		}
+	} else {
+		sub = "ends in " + humanDuration(e.End.Sub(now))
+	}
+
+	sub = sub + " / " + e.CalendarTitle
+	if e.Location != "" {
+		sub = sub + " / " + e.Location
+	}
+
+	eventItem(e, midnight(e.Start)).Subtitle(sub)
+
+	wf.SendFeedback()
+	return nil
+}
+
+// nextEvent returns the first timed event that has not finished yet.
+// Declined events and events that don't block time are ignored.
+func nextEvent(events []*Event, now time.Time) *Event {
+	for _, e := range events {
+		if e.AllDay || e.Free || e.Response == "declined" || !e.End.After(now) {
+			continue
+		}
+		return e
+	}
+
+	return nil
+}
+
+// humanDuration returns d as e.g. "12 min" or "2 hr 5 min".
+func humanDuration(d time.Duration) string {
+	var (
+		mins  = int(d.Minutes())
+		hours = mins / 60
+		days  = hours / 24
+	)
+
+	switch {
+	case mins < 1:
+		return "less than a minute"
+	case hours < 1:
+		return fmt.Sprintf("%d min", mins)
+	case days < 1:
+		if mins%60 == 0 {
+			return fmt.Sprintf("%d hr", hours)
+		}
+		return fmt.Sprintf("%d hr %d min", hours, mins%60)
+	case days == 1:
+		return fmt.Sprintf("1 day %d hr", hours%24)
+	default:
+		return fmt.Sprintf("%d days %d hr", days, hours%24)
+	}
+}
@@ -10,6 +10,7 @@ package main
 
 import (
 	"log"
+	"time"
 )
 
 // quickAdd check if there are configured accounts and pass data to create an event.
@@ -28,12 +29,22 @@ func quickAdd() error {
 }
 
 // createEvent looks for account by calendar ID and create new event in that account.
+// The event is parsed locally and falls back to Google's QuickAdd if parsing fails.
 func createEvent(quick string, calendarID string) error {
-	for _, acc := range accounts {
-		for _, c := range acc.Calendars {
-			if c.ID == calendarID {
-				return acc.QuickAdd(calendarID, quick)
-			}
+	acc, err := accountForCalendar(calendarID)
+	if err != nil {
+		return err
+	}
+
+	spec, err := parseEventSpec(quick, time.Now())
+	if err != nil {
+		log.Printf("[create] couldn't parse %q (%v), using QuickAdd", quick, err)
+		return acc.QuickAdd(calendarID, quick)
+	}
+
+	for _, c := range acc.Calendars {
+		if c.ID == calendarID {
+			return acc.CreateEvent(c, spec)
 		}
 	}
 
@@ -0,0 +1,52 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"log"
+
+	aw "github.com/deanishe/awgo"
+)
+
+// doRSVP responds to an event invitation.
+func doRSVP() error {
+	wf.Configure(aw.TextErrors(true))
+
+	var response string
+	switch {
+	case opts.Yes:
+		response = "accepted"
+	case opts.No:
+		response = "declined"
+	case opts.Maybe:
+		response = "tentative"
+	}
+
+	log.Printf("[rsvp] event=%q, calendar=%q, response=%q", opts.EventID, opts.CalendarID, response)
+
+	acc, err := accountForCalendar(opts.CalendarID)
+	if err != nil {
+		return err
+	}
+
+	if err := acc.RSVP(opts.CalendarID, opts.EventID, response); err != nil {
+		return err
+	}
+
+	// Update cached copies of event so list shows new status
+	return updateCachedEvents(func(e *Event) bool {
+		if e.ID != opts.EventID || e.CalendarID != opts.CalendarID {
+			return false
+		}
+
+		e.Response = response
+		for _, at := range e.Attendees {
+			if at.Self {
+				at.Response = response
+			}
+		}
+
+		return true
+	})
+}
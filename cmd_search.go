@@ -0,0 +1,237 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+)
+
+const (
+	// How long search results are cached for.
+	maxAgeSearch = 5 * time.Minute
+	// Shorter queries aren't searched for, as Alfred runs a search for
+	// every keystroke.
+	minSearchLength = 3
+	// Name of background search job.
+	searchJob = "search"
+)
+
+// doSearch searches active calendars for events matching query.
+func doSearch() error {
+	cals, err := loadActiveCalendars()
+	if err != nil || cals == nil {
+		return err
+	}
+
+	query := strings.TrimSpace(opts.Query)
+	if query == "" && opts.Scripting() {
+		return errors.New("no search query")
+	}
+
+	if len([]rune(query)) < minSearchLength && !opts.Scripting() {
+		wf.NewItem("Search Events").
+			Subtitle(fmt.Sprintf("Search events up to %d days ago or ahead (type at least %d characters)",
+				opts.SearchRange(), minSearchLength)).
+			Valid(false).
+			Icon(iconDefault)
+
+		wf.SendFeedback()
+		return nil
+	}
+
+	var (
+		start, end = searchRange()
+		name       = searchName(query)
+		events     []*Event
+	)
+
+	if opts.Scripting() {
+		reload := func() (interface{}, error) { return searchEvents(cals, query, start, end) }
+		if err := wf.Cache.LoadOrStoreJSON(name, maxAgeSearch, reload, &events); err != nil {
+			return errors.Wrap(err, "search events")
+		}
+		log.Printf("[search] %d result(s) for %q", len(events), query)
+		return writeEvents(os.Stdout, opts.Format, events)
+	}
+
+	// Search in the background, so Alfred isn't blocked while the user is
+	// typing. If a search for an earlier query is still running, wait for
+	// it to finish before starting a new one.
+	if wf.Cache.Expired(name, maxAgeSearch) {
+		// show why the last search failed, then try again next time
+		if errName := searchErrorName(query); wf.Cache.Exists(errName) && !wf.IsRunning(searchJob) {
+			data, err := wf.Cache.Load(errName)
+			if err != nil {
+				return err
+			}
+			if err := wf.Cache.Store(errName, nil); err != nil {
+				return err
+			}
+			return errors.New(string(data))
+		}
+
+		if !wf.IsRunning(searchJob) {
+			cmd := exec.Command(os.Args[0], "update", "search", query)
+			if err := wf.RunInBackground(searchJob, cmd); err != nil {
+				return errors.Wrap(err, "run search")
+			}
+		}
+
+		wf.NewItem("Searching…").
+			Subtitle("Results will appear shortly").
+			Valid(false).
+			Icon(ReloadIcon())
+
+		wf.Rerun(0.2)
+		wf.SendFeedback()
+		return nil
+	}
+
+	if err := wf.Cache.LoadJSON(name, &events); err != nil {
+		return errors.Wrap(err, "load search results")
+	}
+
+	log.Printf("[search] %d result(s) for %q", len(events), query)
+
+	for _, d := range groupByDay(events, start, end) {
+		wf.NewItem(locale.Long(d.Date)).
+			Subtitle(relativeDays(d.Date, false)).
+			Arg(d.Date.Format(timeFormat)).
+			Valid(true).
+			Icon(iconDay).
+			Var("action", "date")
+
+		for _, e := range d.Events {
+			e.MapURL = mapURL(e.Location)
+			eventItem(e, d.Date)
+		}
+	}
+
+	wf.WarnEmpty("No Matching Events", "Try a different query?")
+	wf.SendFeedback()
+	return nil
+}
+
+// doUpdateSearch searches active calendars for query and caches the
+// results for doSearch.
+func doUpdateSearch() error {
+	wf.Configure(aw.TextErrors(true))
+
+	cals, err := activeCalendars()
+	if err != nil {
+		return err
+	}
+
+	query := strings.TrimSpace(opts.Query)
+	start, end := searchRange()
+
+	events, err := searchEvents(cals, query, start, end)
+	if err != nil {
+		err = errors.Wrap(err, "search events")
+		// let doSearch show the error
+		if err2 := wf.Cache.Store(searchErrorName(query), []byte(err.Error())); err2 != nil {
+			log.Printf("[search] ERR: save error: %v", err2)
+		}
+		return err
+	}
+
+	log.Printf("[search] %d result(s) for %q", len(events), query)
+
+	return wf.Cache.StoreJSON(searchName(query), events)
+}
+
+// searchRange returns the period searched for events.
+func searchRange() (start, end time.Time) {
+	return today.AddDate(0, 0, -opts.SearchRange()), today.AddDate(0, 0, opts.SearchRange()+1)
+}
+
+// searchEvents searches calendars in parallel. Events that appear in more
+// than one calendar (e.g. invitations shared between accounts) are only
+// returned once.
+func searchEvents(cals []*Calendar, query string, start, end time.Time) ([]*Event, error) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		events  []*Event
+		errs    []error
+		seen    = map[string]bool{}
+		wanted  = make(map[string]bool, len(cals))
+		matched int
+	)
+
+	for _, c := range cals {
+		wanted[c.ID] = true
+	}
+
+	for _, acc := range accounts {
+		for _, c := range acc.Calendars {
+			if !wanted[c.ID] {
+				continue
+			}
+
+			wg.Add(1)
+			go func(c *Calendar, acc *Account) {
+				defer wg.Done()
+
+				evs, err := acc.SearchEvents(c, query, start, end)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err != nil {
+					log.Printf("[search] ERR: search calendar %q: %v", c.Title, err)
+					errs = append(errs, err)
+					return
+				}
+
+				matched++
+				for _, e := range evs {
+					key := e.IcalUID + "|" + e.Start.Format(time.RFC3339)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+					events = append(events, e)
+				}
+			}(c, acc)
+		}
+	}
+
+	wg.Wait()
+
+	// only fail if no calendar could be searched
+	if matched == 0 && len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	sort.Sort(EventsByStart(events))
+	return events, nil
+}
+
+// searchName returns the cache filename for the results of query.
+func searchName(query string) string {
+	return fmt.Sprintf("search-%x.json", sha1.Sum([]byte(strings.ToLower(query))))
+}
+
+// searchErrorName returns the cache filename for the error a background
+// search for query failed with.
+func searchErrorName(query string) string {
+	return fmt.Sprintf("search-%x.err", sha1.Sum([]byte(strings.ToLower(query))))
+}
+
+// isSearchFile returns true if name is the filename of cached search results.
+func isSearchFile(name string) bool {
+	return strings.HasPrefix(name, "search-") && strings.HasSuffix(name, ".json")
+}
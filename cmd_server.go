@@ -25,7 +25,14 @@ const (
 	quitAfter        = 90 * time.Second
 )
 
-// previewURL returns a preview server URL.
+// functions available in preview.html
+var previewFuncs = template.FuncMap{
+	"date":  func(t time.Time) string { return locale.Medium(t.In(displayTZ)) },
+	"clock": func(t time.Time) string { return t.In(displayTZ).Format(hourFormat) },
+	"zones": otherZoneTimes,
+}
+
+// previewURL returns the preview server URL of an event starting at t.
 func previewURL(t time.Time, eventID string) string {
 	u, _ := url.Parse("http://" + previewServerURL)
 	v := u.Query()
@@ -35,14 +42,15 @@ func previewURL(t time.Time, eventID string) string {
 	return u.String()
 }
 
-// doStartServer starts the preview server.
+// doStartServer starts the preview server. If REMINDERS is set, it also
+// shows reminders for upcoming events and doesn't exit when idle.
 func doStartServer() error {
 	log.Printf("[preview] starting preview server on %s ...", previewServerURL)
 	var (
 		lastRequest = time.Now()
 		mu          = sync.Mutex{}
 		c           = make(chan struct{})
-		templates   = template.Must(template.ParseFiles(filepath.Join(wf.Dir(), "preview.html")))
+		templates   = template.Must(template.New("preview.html").Funcs(previewFuncs).ParseFiles(filepath.Join(wf.Dir(), "preview.html")))
 		mux         = http.NewServeMux()
 		srv         = &http.Server{
 			Addr:    previewServerURL,
@@ -61,6 +69,12 @@ func doStartServer() error {
 		c <- struct{}{}
 	}()
 
+	if opts.Reminders {
+		stop := make(chan struct{})
+		defer close(stop)
+		go runReminders(newNotifier(opts.Notifier), stop)
+	}
+
 	go func() {
 		c := time.Tick(30 * time.Second)
 		for now := range c {
@@ -68,7 +82,7 @@ func doStartServer() error {
 			d := now.Sub(lastRequest)
 			mu.Unlock()
 			log.Printf("[preview] %0.0fs since last request", d.Seconds())
-			if d >= quitAfter {
+			if d >= quitAfter && !opts.Reminders {
 				if err := srv.Shutdown(context.Background()); err != nil {
 					log.Printf("[preview] server shutdown error: %v", err)
 				}
@@ -93,7 +107,7 @@ func doStartServer() error {
 		log.Printf("[preview] date=%s, event=%s", dateStr, eventID)
 
 		// Load events
-		t, err := time.Parse(timeFormat, dateStr)
+		t, err := time.ParseInLocation(timeFormat, dateStr, displayTZ)
 		if err != nil {
 			if _, err := io.WriteString(w, "bad date\n"); err != nil {
 				log.Printf("[error] write server response: %v", err)
@@ -106,7 +120,7 @@ func doStartServer() error {
 			return
 		}
 		log.Printf("[preview] %d active calendar(s)", len(cals))
-		events, err := loadEvents(t, cals...)
+		events, err := loadEvents(t, t.AddDate(0, 0, 1), cals...)
 		if err != nil {
 			log.Printf("[preview] ERR: load events: %v", err)
 			return
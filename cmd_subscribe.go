@@ -0,0 +1,116 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/pkg/errors"
+)
+
+// feedAccount returns the account subscribed feeds belong to, creating it
+// if necessary.
+func feedAccount() *Account {
+	for _, acc := range accounts {
+		if acc.IsFeeds() {
+			return acc
+		}
+	}
+	return &Account{Name: feedAccountName}
+}
+
+// doSubscribe adds an iCalendar feed. If no name is given, the feed's own
+// name is used.
+func doSubscribe() error {
+	wf.Configure(aw.TextErrors(true))
+
+	URL := feedURL(opts.URL)
+	log.Printf("[subscribe] url=%q, name=%q", URL, opts.Name)
+
+	u, err := url.Parse(URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("invalid feed URL: %q", opts.URL)
+	}
+
+	// check the feed works before saving it
+	root, err := fetchFeed(URL)
+	if err != nil {
+		return err
+	}
+
+	f := &Feed{
+		URL:    URL,
+		Name:   opts.Name,
+		Colour: appleColour(root.Text("X-APPLE-CALENDAR-COLOR")),
+	}
+	if f.Name == "" {
+		f.Name = root.Text("X-WR-CALNAME")
+	}
+	if f.Name == "" {
+		f.Name = u.Host
+	}
+
+	var (
+		acc   = feedAccount()
+		feeds = []*Feed{f}
+	)
+
+	// re-subscribing changes the name
+	for _, f2 := range acc.Feeds {
+		if f2.URL != URL {
+			feeds = append(feeds, f2)
+		}
+	}
+	acc.Feeds = feeds
+
+	if err := acc.FetchCalendars(); err != nil {
+		return errors.Wrap(err, "save feeds")
+	}
+
+	fmt.Printf("Subscribed to “%s”. Turn it on in Active Calendars…", f.Name)
+	return nil
+}
+
+// doUnsubscribe removes the feed with the given URL or name.
+func doUnsubscribe() error {
+	wf.Configure(aw.TextErrors(true))
+
+	var (
+		acc     = feedAccount()
+		URL     = feedURL(opts.URL)
+		feeds   []*Feed
+		removed *Feed
+	)
+
+	for _, f := range acc.Feeds {
+		if f.URL == URL || f.Name == opts.URL {
+			removed = f
+			continue
+		}
+		feeds = append(feeds, f)
+	}
+
+	if removed == nil {
+		return fmt.Errorf("not subscribed to %q", opts.URL)
+	}
+
+	if err := wf.Cache.Store(storeName(removed.URL), nil); err != nil {
+		return errors.Wrap(err, "delete event store")
+	}
+
+	acc.Feeds = feeds
+	if len(feeds) == 0 {
+		if err := wf.Cache.Store(acc.CacheName(), nil); err != nil {
+			return errors.Wrap(err, "delete account file")
+		}
+	} else if err := acc.FetchCalendars(); err != nil {
+		return errors.Wrap(err, "save feeds")
+	}
+
+	fmt.Printf("Unsubscribed from “%s”", removed.Name)
+	return nil
+}
@@ -9,7 +9,6 @@
 package main
 
 import (
-	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
@@ -35,13 +34,17 @@ func doUpdateWorkflow() error {
 
 // Fetch and cache list of calendars.
 func doUpdateCalendars() error {
+	wf.Configure(aw.TextErrors(true))
+	return syncCalendars()
+}
+
+// syncCalendars fetches the list of calendars in each account.
+func syncCalendars() error {
 	var (
 		acc *Account
 		err error
 	)
 
-	wf.Configure(aw.TextErrors(true))
-
 	log.Print("[update] reloading calendars…")
 
 	if len(accounts) == 0 {
@@ -53,7 +56,7 @@ func doUpdateCalendars() error {
 			return err
 		}
 
-		if !util.PathExists(acc.IconPath()) {
+		if acc.AvatarURL != "" && !util.PathExists(acc.IconPath()) {
 			if err := download(acc.AvatarURL, acc.IconPath()); err != nil {
 				return errors.Wrap(err, "fetch account avatar")
 			}
@@ -65,18 +68,20 @@ func doUpdateCalendars() error {
 	return nil
 }
 
-// Fetch events for a specified date.
+// Sync events of active calendars.
 func doUpdateEvents() error {
 	wf.Configure(aw.TextErrors(true))
+	return syncEvents()
+}
 
+// syncEvents syncs the event stores of active calendars.
+func syncEvents() error {
 	var (
-		name   = fmt.Sprintf("events-%s.json", opts.StartTime.Format(timeFormat))
-		cals   []*Calendar
-		events []*Event
-		err    error
+		cals []*Calendar
+		err  error
 	)
 
-	log.Printf("[update] fetching events for %s ...", opts.StartTime.Format(timeFormat))
+	log.Print("[update] syncing events ...")
 
 	if err := clearOldFiles(); err != nil {
 		log.Printf("[update] ERR: delete old cache files: %v", err)
@@ -98,72 +103,78 @@ func doUpdateEvents() error {
 
 	log.Printf("[update] %d active calendar(s)", len(cals))
 
-	// Fetch events in parallel
+	// Sync calendars in parallel
 	var (
-		ch     = make(chan *Event)
-		wg     sync.WaitGroup
-		wanted = make(map[string]bool, len(cals)) // IDs of calendars to update
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		colours = map[string]bool{}
+		failed  []error
+		wanted  = make(map[string]bool, len(cals)) // IDs of calendars to update
 	)
 
 	for _, c := range cals {
 		wanted[c.ID] = true
 	}
 
-	wg.Add(len(cals))
-
 	for _, acc := range accounts {
 		for _, c := range acc.Calendars {
 			if _, ok := wanted[c.ID]; !ok {
 				continue
 			}
 
+			wg.Add(1)
 			go func(c *Calendar, acc *Account) {
 				defer wg.Done()
 
-				evs, err := acc.FetchEvents(c, opts.StartTime)
+				fail := func(err error, msg string) {
+					log.Printf("[update] ERR: %s %q: %v", msg, c.Title, err)
+					mu.Lock()
+					failed = append(failed, errors.Wrapf(err, "%s %q", msg, c.Title))
+					mu.Unlock()
+				}
+
+				s, err := LoadStore(c.ID)
 				if err != nil {
-					log.Printf("[update] ERR: fetching events for calendar %q: %v", c.Title, err)
+					fail(err, "load store for calendar")
 					return
 				}
 
-				log.Printf("[update] %d event(s) in calendar %q", len(evs), c.Title)
+				if err := s.Sync(acc, c); err != nil {
+					fail(err, "sync calendar")
+					return
+				}
 
-				for _, e := range evs {
-					ch <- e
+				if err := s.Save(); err != nil {
+					fail(err, "save store for calendar")
+					return
+				}
+
+				mu.Lock()
+				for _, e := range s.Events {
+					colours[e.Colour] = true
 				}
+				mu.Unlock()
 			}(c, acc)
 		}
 	}
 
-	// Close channel when all goroutines are done
-	go func() {
-		wg.Wait()
-		close(ch)
-	}()
-
-	colours := map[string]bool{}
-	for e := range ch {
-		log.Printf("[update] %s", e)
-		events = append(events, e)
-		colours[e.Colour] = true
-	}
-
-	sort.Sort(EventsByStart(events))
-
-	if err := wf.Cache.StoreJSON(name, events); err != nil {
-		return err
-	}
+	wg.Wait()
 
 	// Ensure icons exist in all colours
 	for clr := range colours {
 		_ = ColouredIcon(iconCalendar, clr)
 		_ = ColouredIcon(iconMap, clr)
+		_ = ColouredIcon(iconURL, clr)
+	}
+
+	if len(failed) > 0 {
+		return errors.Wrapf(failed[0], "%d of %d calendar(s) failed to sync", len(failed), len(cals))
 	}
 
 	return nil
 }
 
-// Remove events-* files and icons older than two weeks.
+// Remove stores and icons older than two weeks.
 func clearOldFiles() error {
 	var (
 		cutoff = time.Now().AddDate(0, 0, -14)
@@ -190,7 +201,7 @@ func clearOldFiles() error {
 
 		ext := filepath.Ext(path)
 
-		if (strings.HasPrefix(fi.Name(), "events-") && ext == ".json") || ext == ".png" {
+		if isStoreFile(fi.Name()) || isUnsyncedFile(fi.Name()) || isSearchFile(fi.Name()) || isFreeBusyFile(fi.Name()) || ext == ".png" {
 			if err := os.Remove(path); err != nil {
 				log.Printf("[cache] ERR: delete %q: %v", path, err)
 				return err
@@ -0,0 +1,56 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"regexp"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+// Patterns that match video conference URLs of known providers.
+var conferenceRegexes = []*regexp.Regexp{
+	// Google Meet
+	regexp.MustCompile(`https://meet\.google\.com/[a-z]{3}-[a-z]{4}-[a-z]{3}`),
+	// Zoom
+	regexp.MustCompile(`https://(?:[\w-]+\.)?zoom\.us/(?:j|my|w)/[^\s"'<>]+`),
+	// Microsoft Teams
+	regexp.MustCompile(`https://teams\.microsoft\.com/l/meetup-join/[^\s"'<>]+`),
+	// Webex
+	regexp.MustCompile(`https://[\w-]+\.webex\.com/[^\s"'<>]+`),
+	// Jitsi
+	regexp.MustCompile(`https://meet\.jit\.si/[^\s"'<>]+`),
+}
+
+// conferenceURL returns the URL of event's video conference, or an empty
+// string if it doesn't have one. Conference data are preferred, falling back
+// to the first known conference URL in the event's description or location.
+func conferenceURL(e *calendar.Event) string {
+	if e.ConferenceData != nil {
+		for _, ep := range e.ConferenceData.EntryPoints {
+			if ep.EntryPointType == "video" && ep.Uri != "" {
+				return ep.Uri
+			}
+		}
+	}
+
+	if e.HangoutLink != "" {
+		return e.HangoutLink
+	}
+
+	return findConferenceURL(e.Description, e.Location)
+}
+
+// findConferenceURL returns the first video conference URL in texts.
+func findConferenceURL(texts ...string) string {
+	for _, s := range texts {
+		for _, rx := range conferenceRegexes {
+			if u := rx.FindString(s); u != "" {
+				return u
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import "testing"
+
+func TestFindConferenceURL(t *testing.T) {
+	tests := []struct {
+		in, x string
+	}{
+		{"", ""},
+		{"no link here", ""},
+		{"https://example.com/j/123", ""},
+		{"Join: https://meet.google.com/abc-defg-hij now", "https://meet.google.com/abc-defg-hij"},
+		{`<a href="https://acme.zoom.us/j/123456789?pwd=xyz">Zoom</a>`, "https://acme.zoom.us/j/123456789?pwd=xyz"},
+		{"https://zoom.us/j/987", "https://zoom.us/j/987"},
+		{"Teams: https://teams.microsoft.com/l/meetup-join/19%3ameeting_X%40thread.v2/0", "https://teams.microsoft.com/l/meetup-join/19%3ameeting_X%40thread.v2/0"},
+		{"https://acme.webex.com/meet/bob", "https://acme.webex.com/meet/bob"},
+	}
+
+	for _, td := range tests {
+		v := findConferenceURL(td.in)
+		if v != td.x {
+			t.Errorf("Bad URL for %q. Expected=%q, Got=%q", td.in, td.x, v)
+		}
+	}
+
+	// location is searched after description
+	v := findConferenceURL("", "https://meet.jit.si/standup")
+	if v != "https://meet.jit.si/standup" {
+		t.Errorf("Bad URL for location. Expected=%q, Got=%q", "https://meet.jit.si/standup", v)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	aw "github.com/deanishe/awgo"
+	"github.com/deanishe/awgo/util/build"
+	"github.com/pkg/errors"
+	"howett.net/plist"
+)
+
+// shellEnv is the workflow environment when gcal is run from a shell
+// instead of Alfred. Real environment variables take priority.
+type shellEnv map[string]string
+
+// Lookup implements aw.Env.
+func (env shellEnv) Lookup(key string) (string, bool) {
+	if v, ok := os.LookupEnv(key); ok {
+		return v, true
+	}
+	v, ok := env[key]
+	return v, ok
+}
+
+// workflowEnv returns the environment to create the Workflow with. It
+// returns nil if gcal is run from Alfred. Otherwise, Alfred's variables
+// are generated from the workflow's info.plist and Alfred's preferences,
+// and the workflow's settings are read from info.plist and prefs.plist
+// (where Alfred saves settings that aren't exported with the workflow).
+func workflowEnv() (aw.Env, error) {
+	if os.Getenv("alfred_workflow_bundleid") != "" {
+		return nil, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "find executable")
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return nil, errors.Wrap(err, "find executable")
+	}
+	dir := filepath.Dir(exe)
+
+	info, err := build.NewInfo(build.InfoPlist(filepath.Join(dir, "info.plist")))
+	if err != nil {
+		return nil, errors.Wrap(err, "read workflow info")
+	}
+
+	env := shellEnv(info.Env())
+	delete(env, "alfred_debug")
+
+	var ip struct {
+		Variables map[string]string `plist:"variables"`
+	}
+	if err := readPlist(filepath.Join(dir, "info.plist"), &ip); err != nil {
+		return nil, err
+	}
+
+	prefs := map[string]string{}
+	if err := readPlist(filepath.Join(dir, "prefs.plist"), &prefs); err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+
+	for _, vars := range []map[string]string{ip.Variables, prefs} {
+		for k, v := range vars {
+			env[k] = v
+		}
+	}
+
+	return env, nil
+}
+
+// readPlist unmarshals the property list at path into v.
+func readPlist(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "read plist")
+	}
+	_, err = plist.Unmarshal(data, v)
+	return errors.Wrapf(err, "parse %s", filepath.Base(path))
+}
@@ -11,6 +11,7 @@ package main
 import (
 	"fmt"
 	"net/url"
+	"sort"
 	"time"
 )
 
@@ -25,6 +26,7 @@ type Calendar struct {
 	Title       string // Calendar title
 	Description string // Calendar description
 	Colour      string // CSS hex colour of calendar
+	TimeZone    string // IANA name of calendar's time zone
 
 	AccountName string // Name of account this calendar belongs to
 }
@@ -38,28 +40,106 @@ func (s CalsByTitle) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 // Event is a calendar event
 type Event struct {
-	ID            string    // Event ID
-	IcalUID       string    // Cross-platform UID
-	Title         string    // Event title
-	Description   string    // Event summary/description
-	URL           string    // Event URL
-	MapURL        string    // Google Maps URL
-	Location      string    // Where the event takes place
-	Start         time.Time // Time event started
-	End           time.Time // Time event finished
-	Colour        string    // CSS hex colour of event
-	CalendarID    string    // Calendar event belongs to
-	CalendarTitle string    // Title of calendar event belongs to
+	ID            string          // Event ID
+	IcalUID       string          // Cross-platform UID
+	Title         string          // Event title
+	Description   string          // Event summary/description
+	URL           string          // Event URL
+	MapURL        string          // Google Maps URL
+	Location      string          // Where the event takes place
+	ConferenceURL string          // URL of video conference
+	Start         time.Time       // Time event started (midnight for all-day events)
+	End           time.Time       // Time event finished (exclusive for all-day events)
+	AllDay        bool            // Whether event lasts all day
+	TimeZone      string          // IANA zone event was created in
+	Free          bool            // Whether event doesn't block time on calendar
+	Recurring     bool            // Whether event is an occurrence of a recurring event
+	Reminders     []time.Duration // Popup reminders (nil if event uses defaults)
+	Colour        string          // CSS hex colour of event
+	CalendarID    string          // Calendar event belongs to
+	CalendarTitle string          // Title of calendar event belongs to
+
+	Organizer *Attendee   // Person who created the event
+	Attendees []*Attendee // People invited to the event
+	Response  string      // User's response to invitation (empty if not invited)
 }
 
+// Status returns a description of the user's response to Event invitation.
+// It returns an empty string if user is not an attendee.
+func (e *Event) Status() string { return responseText(e.Response) }
+
 // Duration returns the duration of the Event
 func (e *Event) Duration() time.Duration { return e.End.Sub(e.Start) }
 
+// LastDay returns midnight on the last day of the Event.
+func (e *Event) LastDay() time.Time {
+	if e.AllDay && e.End.After(e.Start) {
+		return midnight(e.End.AddDate(0, 0, -1))
+	}
+	return midnight(e.End)
+}
+
+// Days returns the days an all-day Event spans. For timed events, it returns
+// the day the event starts on.
+func (e *Event) Days() []time.Time {
+	var (
+		first = midnight(e.Start)
+		days  = []time.Time{first}
+	)
+
+	if !e.AllDay {
+		return days
+	}
+
+	for t := first.AddDate(0, 0, 1); !t.After(e.LastDay()); t = t.AddDate(0, 0, 1) {
+		days = append(days, t)
+	}
+
+	return days
+}
+
 func (e *Event) String() string {
 	date := e.Start.Format("2/1 at 15:04")
 	return fmt.Sprintf("\"%s\" on %s for %0.0fm", e.Title, date, e.Duration().Minutes())
 }
 
+// Attendee is a person invited to an Event.
+type Attendee struct {
+	Name      string // Attendee's name
+	Email     string // Attendee's email address
+	Response  string // One of "needsAction", "declined", "tentative" or "accepted"
+	Optional  bool   // Whether attendance is optional
+	Organizer bool   // Whether attendee is the event's organiser
+	Self      bool   // Whether attendee is the current user
+}
+
+// String returns attendee's name or email address if there is no name.
+func (a *Attendee) String() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return a.Email
+}
+
+// Status returns a description of attendee's response.
+func (a *Attendee) Status() string { return responseText(a.Response) }
+
+// Human-readable version of API response status.
+func responseText(status string) string {
+	switch status {
+	case "accepted":
+		return "accepted"
+	case "tentative":
+		return "tentative"
+	case "declined":
+		return "declined"
+	case "needsAction":
+		return "needs action"
+	default:
+		return ""
+	}
+}
+
 // EventsByStart sorts a slice of Events by start time.
 type EventsByStart []*Event
 
@@ -67,6 +147,56 @@ func (s EventsByStart) Len() int           { return len(s) }
 func (s EventsByStart) Less(i, j int) bool { return s[i].Start.Before(s[j].Start) }
 func (s EventsByStart) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
+// Day is a date and the events that take place on it.
+type Day struct {
+	Date   time.Time // Midnight on given day
+	Events []*Event  // All-day events followed by timed events
+}
+
+// groupByDay sorts events into Days between start and end. All-day events
+// are placed on every day they span, before the day's timed events.
+func groupByDay(events []*Event, start, end time.Time) []*Day {
+	var (
+		allDay = map[string][]*Event{}
+		timed  = map[string][]*Event{}
+		dates  = map[string]time.Time{}
+		keys   []string
+	)
+
+	start = midnight(start)
+	for _, e := range events {
+		for _, t := range e.Days() {
+			if t.Before(start) || !t.Before(end) {
+				continue
+			}
+
+			key := t.Format(timeFormat)
+			if _, ok := dates[key]; !ok {
+				dates[key] = t
+				keys = append(keys, key)
+			}
+
+			if e.AllDay {
+				allDay[key] = append(allDay[key], e)
+			} else {
+				timed[key] = append(timed[key], e)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+
+	days := make([]*Day, len(keys))
+	for i, key := range keys {
+		days[i] = &Day{
+			Date:   dates[key],
+			Events: append(allDay[key], timed[key]...),
+		}
+	}
+
+	return days
+}
+
 // URL that points to location on Google Maps or Apple Maps.
 func mapURL(location string) string {
 	if location == "" {
@@ -0,0 +1,209 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// exportICal returns a VCALENDAR containing events. Occurrences of
+// recurring events are exported as standalone events with their own UIDs
+// (see exportUID), as a RECURRENCE-ID without its series is invalid.
+func exportICal(events []*Event, now time.Time) *icalComponent {
+	var (
+		vc    = &icalComponent{Name: "VCALENDAR"}
+		uids  = map[string]int{}
+		zones = map[string]*zoneSpan{}
+		names []string
+	)
+
+	vc.Set("VERSION", "2.0", nil)
+	vc.Set("PRODID", icalProdID, nil)
+	vc.Set("CALSCALE", "GREGORIAN", nil)
+
+	// cached events may predate Event.Recurring
+	for _, e := range events {
+		uids[eventUID(e)]++
+	}
+
+	var vevents []*icalComponent
+	for _, e := range events {
+		loc := eventZone(e)
+		if loc != nil {
+			z, ok := zones[loc.String()]
+			if !ok {
+				z = &zoneSpan{loc: loc, start: e.Start, end: e.End}
+				zones[loc.String()] = z
+				names = append(names, loc.String())
+			}
+			if e.Start.Before(z.start) {
+				z.start = e.Start
+			}
+			if e.End.After(z.end) {
+				z.end = e.End
+			}
+		}
+
+		v := vevent(e, loc, now)
+		if e.Recurring || uids[eventUID(e)] > 1 {
+			v.Set("UID", exportUID(e), nil)
+		}
+		vevents = append(vevents, v)
+	}
+
+	// time zones must be defined before they're used
+	sort.Strings(names)
+	for _, name := range names {
+		z := zones[name]
+		vc.Components = append(vc.Components, vtimezone(z.loc, z.start.AddDate(0, 0, -1), z.end.AddDate(0, 0, 1)))
+	}
+	vc.Components = append(vc.Components, vevents...)
+
+	return vc
+}
+
+// zoneSpan is the period a time zone is used in.
+type zoneSpan struct {
+	loc        *time.Location
+	start, end time.Time
+}
+
+// eventUID returns the iCalendar UID of Event.
+func eventUID(e *Event) string {
+	if e.IcalUID != "" {
+		return e.IcalUID
+	}
+	return e.ID
+}
+
+// exportUID returns a UID for an occurrence of a recurring event that is
+// exported on its own. It is derived from the series' UID and the
+// occurrence's start, so exporting the occurrence again gives the same UID.
+func exportUID(e *Event) string {
+	return eventUID(e) + "-" + occurrenceKey(e.Start, e.AllDay)
+}
+
+// eventZone returns the zone a timed event's times should be exported
+// in, or nil if they should be UTC.
+func eventZone(e *Event) *time.Location {
+	if e.AllDay || e.TimeZone == "" || e.TimeZone == "UTC" {
+		return nil
+	}
+
+	loc, err := time.LoadLocation(e.TimeZone)
+	if err != nil {
+		log.Printf("[export] ERR: load zone %q: %v", e.TimeZone, err)
+		return nil
+	}
+	return loc
+}
+
+// vevent converts Event into a VEVENT. Times are in loc if it isn't nil.
+func vevent(e *Event, loc *time.Location, now time.Time) *icalComponent {
+	v := &icalComponent{Name: "VEVENT"}
+
+	v.Set("UID", eventUID(e), nil)
+	v.SetTime("DTSTAMP", now, false)
+	if loc != nil {
+		v.SetTimeIn("DTSTART", e.Start, loc)
+		v.SetTimeIn("DTEND", e.End, loc)
+	} else {
+		v.SetTime("DTSTART", e.Start, e.AllDay)
+		v.SetTime("DTEND", e.End, e.AllDay)
+	}
+
+	v.SetText("SUMMARY", e.Title)
+	if e.Description != "" {
+		v.SetText("DESCRIPTION", e.Description)
+	}
+	if e.Location != "" {
+		v.SetText("LOCATION", e.Location)
+	}
+	if e.URL != "" {
+		v.Set("URL", e.URL, nil)
+	}
+	if e.ConferenceURL != "" {
+		v.Set("X-GOOGLE-CONFERENCE", e.ConferenceURL, nil)
+	}
+
+	if e.Free {
+		v.Set("TRANSP", "TRANSPARENT", nil)
+	} else {
+		v.Set("TRANSP", "OPAQUE", nil)
+	}
+
+	if e.Organizer != nil && e.Organizer.Email != "" {
+		v.Props = append(v.Props, attendeeProp(e.Organizer, true))
+	}
+	for _, a := range e.Attendees {
+		if a.Email != "" {
+			v.Props = append(v.Props, attendeeProp(a, false))
+		}
+	}
+
+	for _, d := range e.Reminders {
+		v.Components = append(v.Components, valarm(e.Title, d))
+	}
+
+	return v
+}
+
+// vtimezone returns a VTIMEZONE describing loc between start and end.
+// Go doesn't expose a zone's rules, so each change of UTC offset is
+// listed as a separate observance.
+func vtimezone(loc *time.Location, start, end time.Time) *icalComponent {
+	tz := &icalComponent{Name: "VTIMEZONE"}
+	tz.Set("TZID", loc.String(), nil)
+
+	observance := func(t time.Time, from int) {
+		name, offset := t.Zone()
+		c := &icalComponent{Name: "STANDARD"}
+		if t.IsDST() {
+			c.Name = "DAYLIGHT"
+		}
+		// onset is in the local time before the change
+		c.Set("DTSTART", t.In(time.FixedZone("", from)).Format(icalDateTime), nil)
+		c.Set("TZOFFSETFROM", icalOffset(from), nil)
+		c.Set("TZOFFSETTO", icalOffset(offset), nil)
+		c.Set("TZNAME", name, nil)
+		tz.Components = append(tz.Components, c)
+	}
+
+	t := time.Unix(start.Unix(), 0).In(loc)
+	_, prev := t.Zone()
+	observance(t, prev)
+
+	for t.Before(end) {
+		next := t.Add(24 * time.Hour)
+		if _, offset := next.Zone(); offset != prev {
+			// find the moment the offset changed
+			lo, hi := t.Unix(), next.Unix()
+			for hi-lo > 1 {
+				mid := (lo + hi) / 2
+				if _, o := time.Unix(mid, 0).In(loc).Zone(); o == prev {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			observance(time.Unix(hi, 0).In(loc), prev)
+			prev = offset
+		}
+		t = next
+	}
+
+	return tz
+}
+
+// icalOffset formats a UTC offset in seconds, e.g. "+0100".
+func icalOffset(secs int) string {
+	sign := "+"
+	if secs < 0 {
+		sign, secs = "-", -secs
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, secs/3600, secs%3600/60)
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportICal(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		now    = time.Date(2019, 4, 1, 12, 0, 0, 0, time.UTC)
+		start  = time.Date(2019, 4, 3, 10, 0, 0, 0, berlin)
+		events = []*Event{
+			{
+				ID:          "abc_20190403T080000Z",
+				IcalUID:     "abc@google.com",
+				Title:       "Planning; Q3, part 1",
+				Description: "Agenda:\n1. Budget",
+				Location:    "Room 1",
+				Start:       start,
+				End:         start.Add(time.Hour),
+				TimeZone:    "Europe/Berlin",
+				Recurring:   true,
+				Reminders:   []time.Duration{15 * time.Minute},
+				Organizer:   &Attendee{Name: "Alice", Email: "alice@example.com"},
+				Attendees: []*Attendee{
+					{Name: "Smith, Bob", Email: "bob@example.com", Response: "accepted"},
+					{Email: "me@example.com", Response: "tentative", Optional: true, Self: true},
+				},
+			},
+			{
+				ID:        "abc_20190410T080000Z",
+				IcalUID:   "abc@google.com",
+				Title:     "Planning; Q3, part 2",
+				Start:     start.AddDate(0, 0, 7),
+				End:       start.AddDate(0, 0, 7).Add(time.Hour),
+				TimeZone:  "Europe/Berlin",
+				Recurring: true,
+			},
+			{
+				ID:     "holiday",
+				Title:  "Holiday",
+				Start:  time.Date(2019, 4, 19, 0, 0, 0, 0, displayTZ),
+				End:    time.Date(2019, 4, 23, 0, 0, 0, 0, displayTZ),
+				AllDay: true,
+				Free:   true,
+			},
+		}
+	)
+
+	data := exportICal(events, now).String()
+
+	for _, line := range strings.Split(strings.TrimSuffix(data, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line not folded: %q", line)
+		}
+	}
+
+	for _, s := range []string{
+		"\r\nDTSTART;TZID=Europe/Berlin:20190403T100000\r\n",
+		"\r\nUID:abc@google.com-20190410T080000Z\r\n",
+		"\r\nDTSTART;VALUE=DATE:20190419\r\n",
+		"\r\nSUMMARY:Planning\\; Q3\\, part 1\r\n",
+		"\r\nTZOFFSETTO:+0200\r\n",
+		"\r\nDTSTAMP:20190401T120000Z\r\n",
+	} {
+		if !strings.Contains(data, s) {
+			t.Errorf("Export doesn't contain %q", s)
+		}
+	}
+
+	if strings.Contains(data, "RECURRENCE-ID") {
+		t.Error("Export contains RECURRENCE-ID without series")
+	}
+
+	root, err := parseICal(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(root.Children("VTIMEZONE")); n != 1 {
+		t.Errorf("Expected 1 VTIMEZONE, got %d", n)
+	}
+
+	vevents := root.Children("VEVENT")
+	if len(vevents) != len(events) {
+		t.Fatalf("Expected %d VEVENTs, got %d", len(events), len(vevents))
+	}
+
+	cal := &Calendar{ID: "cal"}
+	for i, v := range vevents {
+		e, err := eventFromVEvent(v, cal, "me@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		x := events[i]
+		if e.Title != x.Title || e.Description != x.Description || e.Location != x.Location ||
+			e.AllDay != x.AllDay || e.Free != x.Free {
+			t.Errorf("#%d: Bad event. Expected=%+v, Got=%+v", i, x, e)
+		}
+		if !e.Start.Equal(x.Start) || !e.End.Equal(x.End) {
+			t.Errorf("#%d: Bad times. Expected=%v – %v, Got=%v – %v", i, x.Start, x.End, e.Start, e.End)
+		}
+		uid := eventUID(x)
+		if x.Recurring {
+			uid = exportUID(x)
+		}
+		if e.IcalUID != uid {
+			t.Errorf("#%d: Bad UID. Expected=%q, Got=%q", i, uid, e.IcalUID)
+		}
+		if len(e.Attendees) != len(x.Attendees) || len(e.Reminders) != len(x.Reminders) {
+			t.Errorf("#%d: Bad attendees or reminders: %+v", i, e)
+		}
+	}
+
+	e, _ := eventFromVEvent(vevents[0], cal, "me@example.com")
+	if e.Organizer == nil || e.Organizer.Email != "alice@example.com" ||
+		e.Attendees[0].Name != "Smith, Bob" || !e.Attendees[1].Optional || e.Response != "tentative" {
+		t.Errorf("Bad people: %+v, %+v", e.Organizer, e.Attendees)
+	}
+}
+
+func TestVTimezone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tz := vtimezone(berlin, time.Date(2019, 1, 1, 0, 0, 0, 0, berlin), time.Date(2019, 12, 31, 0, 0, 0, 0, berlin))
+
+	var x = []struct {
+		name, start, from, to string
+	}{
+		{"STANDARD", "20190101T000000", "+0100", "+0100"},
+		{"DAYLIGHT", "20190331T020000", "+0100", "+0200"},
+		{"STANDARD", "20191027T030000", "+0200", "+0100"},
+	}
+
+	if len(tz.Components) != len(x) {
+		t.Fatalf("Expected %d observances, got %d", len(x), len(tz.Components))
+	}
+
+	for i, c := range tz.Components {
+		if c.Name != x[i].name || c.Text("DTSTART") != x[i].start ||
+			c.Text("TZOFFSETFROM") != x[i].from || c.Text("TZOFFSETTO") != x[i].to {
+			t.Errorf("#%d: Bad observance. Expected=%v, Got=%s", i, x[i], c)
+		}
+	}
+}
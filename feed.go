@@ -0,0 +1,132 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// feedAccountName is the name of the pseudo-account that subscribed
+// feeds belong to.
+const feedAccountName = "Subscriptions"
+
+var errReadOnly = errors.New("subscribed calendars are read-only")
+
+// Feed is a read-only iCalendar feed, e.g. a published on-call rota or
+// a list of public holidays.
+type Feed struct {
+	URL    string
+	Name   string
+	Colour string // CSS hex colour
+}
+
+// feedProvider fetches events from subscribed feeds. Each feed is
+// a calendar.
+type feedProvider struct {
+	feeds []*Feed
+}
+
+var _ CalendarProvider = (*feedProvider)(nil)
+
+// IsFeeds returns true if Account is the pseudo-account of subscribed feeds.
+func (a *Account) IsFeeds() bool { return a.Name == feedAccountName }
+
+// feedURL returns the HTTP URL of a feed. webcal:// URLs are changed to
+// https://.
+func feedURL(URL string) string {
+	if strings.HasPrefix(URL, "webcal://") {
+		return "https://" + strings.TrimPrefix(URL, "webcal://")
+	}
+	return URL
+}
+
+// fetchFeed retrieves and parses the feed at URL.
+func fetchFeed(URL string) (*icalComponent, error) {
+	resp, err := http.Get(URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch feed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("fetch feed %s: %s", URL, resp.Status)
+	}
+
+	root, err := parseICal(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse feed %s", URL)
+	}
+
+	if root.Name != "VCALENDAR" {
+		return nil, fmt.Errorf("%s is not an iCalendar feed", URL)
+	}
+
+	// feeds with unknown zones are still shown, in DISPLAY_TZ
+	if err := resolveZones(root); err != nil {
+		log.Printf("[feed] ERR: %s: %v", URL, err)
+	}
+
+	return root, nil
+}
+
+// Calendars implements CalendarProvider.
+func (p *feedProvider) Calendars() ([]*Calendar, error) {
+	var cals []*Calendar
+	for _, f := range p.feeds {
+		cals = append(cals, &Calendar{
+			ID:          f.URL,
+			Title:       f.Name,
+			Description: f.URL,
+			Colour:      f.Colour,
+			AccountName: feedAccountName,
+		})
+	}
+	return cals, nil
+}
+
+// Events implements CalendarProvider. The whole feed is downloaded and
+// recurring events are expanded locally.
+func (p *feedProvider) Events(cal *Calendar, start, end time.Time) ([]*Event, error) {
+	root, err := fetchFeed(cal.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// UIDs are required, but not every feed has them
+	for _, v := range root.Children("VEVENT") {
+		if v.Text("UID") == "" {
+			var s string
+			if p := v.Prop("DTSTART"); p != nil {
+				s = p.Value
+			}
+			v.Set("UID", fmt.Sprintf("%x", sha1.Sum([]byte(v.Text("SUMMARY")+s))), nil)
+		}
+	}
+
+	events := expandVEvents(root, cal, "", start, end, func(uid string) string { return uid })
+	log.Printf("[feed] %d event(s) in %q", len(events), cal.Title)
+
+	return events, nil
+}
+
+// CreateEvent implements CalendarProvider.
+func (p *feedProvider) CreateEvent(cal *Calendar, spec *EventSpec) error { return errReadOnly }
+
+// UpdateEvent implements CalendarProvider.
+func (p *feedProvider) UpdateEvent(cal *Calendar, e *Event, field string) error {
+	return errReadOnly
+}
+
+// DeleteEvent implements CalendarProvider.
+func (p *feedProvider) DeleteEvent(cal *Calendar, eventID string) error { return errReadOnly }
+
+// ImportEvent implements CalendarProvider.
+func (p *feedProvider) ImportEvent(cal *Calendar, vc *icalComponent) error { return errReadOnly }
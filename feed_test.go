@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+const testFeed = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"X-WR-CALNAME:On-call\r\n" +
+	// weekly, but not on the 10th, and the 17th is moved and the 24th cancelled
+	"BEGIN:VEVENT\r\n" +
+	"UID:rota\r\n" +
+	"SUMMARY:Handover\r\n" +
+	"DTSTART:20190403T090000Z\r\n" +
+	"DTEND:20190403T093000Z\r\n" +
+	"RRULE:FREQ=WEEKLY;COUNT=5\r\n" +
+	"EXDATE:20190410T090000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:rota\r\n" +
+	"SUMMARY:Handover (late)\r\n" +
+	"RECURRENCE-ID:20190417T090000Z\r\n" +
+	"DTSTART:20190417T140000Z\r\n" +
+	"DTEND:20190417T143000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:rota\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"RECURRENCE-ID:20190424T090000Z\r\n" +
+	"DTSTART:20190424T090000Z\r\n" +
+	"END:VEVENT\r\n" +
+	// no UID
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Release\r\n" +
+	"DTSTART:20190405T150000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestFeedProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/calendar")
+		fmt.Fprint(w, testFeed)
+	}))
+	defer srv.Close()
+
+	p := &feedProvider{[]*Feed{{URL: srv.URL, Name: "On-call", Colour: "#123456"}}}
+
+	cals, err := p.Calendars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cals) != 1 || cals[0].ID != srv.URL || cals[0].AccountName != feedAccountName {
+		t.Fatalf("Bad calendars: %+v", cals)
+	}
+
+	var (
+		start = time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+		end   = start.AddDate(0, 1, 7)
+	)
+
+	events, err := p.Events(cals[0], start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Sort(EventsByStart(events))
+
+	x := []struct {
+		id, title string
+		start     time.Time
+	}{
+		{"rota#20190403T090000Z", "Handover", time.Date(2019, 4, 3, 9, 0, 0, 0, time.UTC)},
+		{"", "Release", time.Date(2019, 4, 5, 15, 0, 0, 0, time.UTC)},
+		{"rota#20190417T090000Z", "Handover (late)", time.Date(2019, 4, 17, 14, 0, 0, 0, time.UTC)},
+		{"rota#20190501T090000Z", "Handover", time.Date(2019, 5, 1, 9, 0, 0, 0, time.UTC)},
+	}
+
+	if len(events) != len(x) {
+		t.Fatalf("Expected %d events, got %d", len(x), len(events))
+	}
+
+	for i, e := range events {
+		if x[i].id != "" && e.ID != x[i].id {
+			t.Errorf("#%d: Bad ID. Expected=%q, Got=%q", i, x[i].id, e.ID)
+		}
+		if e.ID == "" {
+			t.Errorf("#%d: Event has no ID", i)
+		}
+		if e.Title != x[i].title {
+			t.Errorf("#%d: Bad title. Expected=%q, Got=%q", i, x[i].title, e.Title)
+		}
+		if !e.Start.Equal(x[i].start) {
+			t.Errorf("#%d: Bad start. Expected=%v, Got=%v", i, x[i].start, e.Start)
+		}
+		if e.CalendarID != srv.URL || e.Colour != "#123456" {
+			t.Errorf("#%d: Bad calendar: %q, %q", i, e.CalendarID, e.Colour)
+		}
+	}
+
+	if err := p.DeleteEvent(cals[0], events[0].ID); err != errReadOnly {
+		t.Errorf("Deleted event from feed: %v", err)
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	aw "github.com/deanishe/awgo"
+)
+
+// eventFilter restricts a list of events, e.g. "cal:work" or "after:14:00".
+type eventFilter struct {
+	Key   *filterKey
+	Value string // lowercase
+}
+
+// Valid returns true if the filter's value is acceptable for its key.
+func (f eventFilter) Valid() bool {
+	if f.Value == "" {
+		return false
+	}
+	if f.Key.valid != nil {
+		return f.Key.valid(f.Value)
+	}
+	return true
+}
+
+// Match returns true if the filter accepts Event.
+func (f eventFilter) Match(e *Event) bool { return f.Key.match(e, f.Value) }
+
+// filterKey is a property events can be filtered on.
+type filterKey struct {
+	Name    string   // prefix in query, e.g. "cal"
+	Help    string   // description shown in suggestions
+	Example string   // example filter
+	Values  []string // fixed values, if any
+
+	valid func(v string) bool
+	match func(e *Event, v string) bool
+}
+
+// Keys recognised in event queries, in the order they are suggested.
+var filterKeys = []*filterKey{
+	{
+		Name:    "cal",
+		Help:    "Only events in calendar",
+		Example: "cal:work",
+		match:   func(e *Event, v string) bool { return contains(e.CalendarTitle, v) },
+	},
+	{
+		Name:    "at",
+		Help:    "Only events at location",
+		Example: "at:office",
+		match:   func(e *Event, v string) bool { return contains(e.Location, v) },
+	},
+	{
+		Name:    "with",
+		Help:    "Only events with attendee",
+		Example: "with:alice",
+		match: func(e *Event, v string) bool {
+			for _, a := range e.Attendees {
+				if !a.Self && (contains(a.Name, v) || contains(a.Email, v)) {
+					return true
+				}
+			}
+			return false
+		},
+	},
+	{
+		Name:    "is",
+		Help:    "Only events with status",
+		Example: "is:accepted",
+		Values:  []string{"accepted", "tentative", "declined", "pending", "allday", "free", "busy"},
+		match: func(e *Event, v string) bool {
+			switch v {
+			case "pending":
+				return e.Response == "needsAction"
+			case "allday":
+				return e.AllDay
+			case "free":
+				return e.Free
+			case "busy":
+				return !e.Free
+			default:
+				return strings.ToLower(e.Response) == v
+			}
+		},
+	},
+	{
+		Name:    "has",
+		Help:    "Only events with",
+		Example: "has:meet",
+		Values:  []string{"meet", "location", "guests", "description"},
+		match: func(e *Event, v string) bool {
+			switch v {
+			case "meet":
+				return e.ConferenceURL != ""
+			case "location":
+				return e.Location != ""
+			case "guests":
+				return len(e.Attendees) > 0
+			default:
+				return e.Description != ""
+			}
+		},
+	},
+	{
+		Name:    "after",
+		Help:    "Only events starting at or after time",
+		Example: "after:14:00",
+		valid:   func(v string) bool { _, ok := parseClock(v); return ok },
+		match: func(e *Event, v string) bool {
+			c, _ := parseClock(v)
+			return !e.AllDay && !e.Start.In(displayTZ).Before(c.on(e.Start.In(displayTZ)))
+		},
+	},
+	{
+		Name:    "before",
+		Help:    "Only events starting before time",
+		Example: "before:12:00",
+		valid:   func(v string) bool { _, ok := parseClock(v); return ok },
+		match: func(e *Event, v string) bool {
+			c, _ := parseClock(v)
+			return !e.AllDay && e.Start.In(displayTZ).Before(c.on(e.Start.In(displayTZ)))
+		},
+	},
+}
+
+func init() {
+	// fixed values are only valid if they're in the list
+	for _, k := range filterKeys {
+		if len(k.Values) == 0 {
+			continue
+		}
+		values := k.Values
+		k.valid = func(v string) bool {
+			for _, s := range values {
+				if s == v {
+					return true
+				}
+			}
+			return false
+		}
+	}
+}
+
+// lookupFilterKey returns the filterKey called name or nil.
+func lookupFilterKey(name string) *filterKey {
+	name = strings.ToLower(name)
+	for _, k := range filterKeys {
+		if k.Name == name {
+			return k
+		}
+	}
+	return nil
+}
+
+// contains reports whether s contains lowercase substr, ignoring case.
+func contains(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), substr)
+}
+
+// splitQuery splits query into words. Double quotes may be used to include
+// spaces in a word, e.g. `cal:"Work Stuff"`.
+func splitQuery(query string) []string {
+	var (
+		words  []string
+		word   strings.Builder
+		quoted bool
+		inWord bool
+	)
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+// parseFilters extracts filters from query. It returns the filters and
+// the rest of the query. Filters with invalid values (e.g. "is:foo") are
+// also returned, but are ignored by filterEvents.
+func parseFilters(query string) (filters []eventFilter, text string) {
+	var words []string
+	for _, w := range splitQuery(query) {
+		if i := strings.Index(w, ":"); i > 0 {
+			if k := lookupFilterKey(w[:i]); k != nil {
+				filters = append(filters, eventFilter{k, strings.ToLower(w[i+1:])})
+				continue
+			}
+		}
+		words = append(words, w)
+	}
+
+	return filters, strings.Join(words, " ")
+}
+
+// filterEvents returns the events that match all valid filters.
+func filterEvents(events []*Event, filters []eventFilter) []*Event {
+	var valid []eventFilter
+	for _, f := range filters {
+		if f.Valid() {
+			valid = append(valid, f)
+		}
+	}
+
+	if len(valid) == 0 {
+		return events
+	}
+
+	var matches []*Event
+outer:
+	for _, e := range events {
+		for _, f := range valid {
+			if !f.Match(e) {
+				continue outer
+			}
+		}
+		matches = append(matches, e)
+	}
+
+	return matches
+}
+
+// filterSuggestions adds items to autocomplete the last word of query
+// as a filter. Calendar names are taken from cals and locations and
+// attendees from events.
+func filterSuggestions(query string, cals []*Calendar, events []*Event) {
+	if query == "" || unicode.IsSpace(rune(query[len(query)-1])) {
+		return
+	}
+
+	words := splitQuery(query)
+	if len(words) == 0 {
+		return
+	}
+
+	var (
+		last   = words[len(words)-1]
+		prefix = strings.TrimSpace(query[:lastWordIndex(query)])
+	)
+
+	if prefix != "" {
+		prefix += " "
+	}
+
+	i := strings.Index(last, ":")
+	if i < 0 {
+		// suggest keys
+		if len(last) < 2 {
+			return
+		}
+		for _, k := range filterKeys {
+			if strings.HasPrefix(k.Name, strings.ToLower(last)) {
+				wf.NewItem(k.Name + ":").
+					Subtitle(k.Help).
+					Autocomplete(prefix + k.Name + ":").
+					Valid(false).
+					Icon(iconDefault)
+			}
+		}
+		return
+	}
+
+	k := lookupFilterKey(last[:i])
+	if k == nil {
+		return
+	}
+
+	f := eventFilter{k, strings.ToLower(last[i+1:])}
+	values := filterValues(k, cals, events)
+
+	if len(values) == 0 && !f.Valid() {
+		wf.NewItem(k.Name + ":…").
+			Subtitle(k.Help + ", e.g. " + k.Example).
+			Valid(false).
+			Icon(aw.IconWarning)
+		return
+	}
+
+	for _, v := range values {
+		if !contains(v, f.Value) || strings.ToLower(v) == f.Value {
+			continue
+		}
+		s := v
+		if strings.ContainsAny(s, " \t") {
+			s = `"` + s + `"`
+		}
+		wf.NewItem(k.Name + ":" + v).
+			Subtitle(k.Help).
+			Autocomplete(prefix + k.Name + ":" + s + " ").
+			Valid(false).
+			Icon(iconDefault)
+	}
+}
+
+// lastWordIndex returns the position in query where the final word starts.
+func lastWordIndex(query string) int {
+	var (
+		quoted bool
+		start  int
+	)
+	for i, r := range query {
+		if r == '"' {
+			quoted = !quoted
+		} else if unicode.IsSpace(r) && !quoted {
+			start = i + 1
+		}
+	}
+	return start
+}
+
+// filterValues returns possible values for filter key k.
+func filterValues(k *filterKey, cals []*Calendar, events []*Event) []string {
+	if len(k.Values) > 0 {
+		return k.Values
+	}
+
+	seen := map[string]bool{}
+	add := func(s string) {
+		if s != "" {
+			seen[s] = true
+		}
+	}
+
+	switch k.Name {
+	case "cal":
+		for _, c := range cals {
+			add(c.Title)
+		}
+	case "at":
+		for _, e := range events {
+			add(e.Location)
+		}
+	case "with":
+		for _, e := range events {
+			for _, a := range e.Attendees {
+				if !a.Self {
+					add(a.String())
+				}
+			}
+		}
+	}
+
+	values := make([]string, 0, len(seen))
+	for s := range seen {
+		values = append(values, s)
+	}
+	sort.Strings(values)
+
+	return values
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitQuery(t *testing.T) {
+	tests := []struct {
+		in string
+		x  []string
+	}{
+		{"", nil},
+		{"  lunch  ", []string{"lunch"}},
+		{"lunch cal:work", []string{"lunch", "cal:work"}},
+		{`cal:"Work Stuff" lunch`, []string{"cal:Work Stuff", "lunch"}},
+		{`cal:"Work St`, []string{"cal:Work St"}},
+	}
+
+	for _, td := range tests {
+		if v := splitQuery(td.in); !reflect.DeepEqual(v, td.x) {
+			t.Errorf("splitQuery(%q): Expected=%q, Got=%q", td.in, td.x, v)
+		}
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	tests := []struct {
+		in   string
+		keys []string
+		vals []string
+		text string
+	}{
+		{"lunch", nil, nil, "lunch"},
+		{"lunch CAL:Work", []string{"cal"}, []string{"work"}, "lunch"},
+		{"after:14:00 with:alice sync", []string{"after", "with"}, []string{"14:00", "alice"}, "sync"},
+		// unknown keys and times are plain text
+		{"foo:bar 12:30", nil, nil, "foo:bar 12:30"},
+		{"is:", []string{"is"}, []string{""}, ""},
+	}
+
+	for _, td := range tests {
+		filters, text := parseFilters(td.in)
+		var keys, vals []string
+		for _, f := range filters {
+			keys = append(keys, f.Key.Name)
+			vals = append(vals, f.Value)
+		}
+		if !reflect.DeepEqual(keys, td.keys) || !reflect.DeepEqual(vals, td.vals) || text != td.text {
+			t.Errorf("parseFilters(%q): Expected=(%v, %v, %q), Got=(%v, %v, %q)",
+				td.in, td.keys, td.vals, td.text, keys, vals, text)
+		}
+	}
+}
+
+func TestFilterEvents(t *testing.T) {
+	at := func(h int) time.Time { return time.Date(2019, 4, 3, h, 0, 0, 0, displayTZ) }
+	var (
+		standup = &Event{Title: "Standup", CalendarTitle: "Work", Start: at(9), End: at(10),
+			ConferenceURL: "https://meet.google.com/abc", Response: "accepted",
+			Attendees: []*Attendee{{Name: "Me", Self: true}, {Name: "Alice", Email: "alice@example.com"}}}
+		lunch = &Event{Title: "Lunch", CalendarTitle: "Personal", Start: at(13), End: at(14),
+			Location: "Cafe Rouge", Free: true}
+		holiday = &Event{Title: "Holiday", CalendarTitle: "Personal", Start: at(0), End: at(24), AllDay: true}
+		events  = []*Event{standup, lunch, holiday}
+	)
+
+	tests := []struct {
+		query string
+		x     []*Event
+	}{
+		{"", events},
+		{"cal:work", []*Event{standup}},
+		{"cal:pers", []*Event{lunch, holiday}},
+		{"at:rouge", []*Event{lunch}},
+		{"with:alice", []*Event{standup}},
+		{"with:me", nil},
+		{"is:accepted", []*Event{standup}},
+		{"is:free", []*Event{lunch}},
+		{"is:allday", []*Event{holiday}},
+		{"has:meet", []*Event{standup}},
+		{"has:location", []*Event{lunch}},
+		{"after:12:00", []*Event{lunch}},
+		{"before:12pm", []*Event{standup}},
+		{"cal:personal after:9:00", []*Event{lunch}},
+		// invalid filters are ignored
+		{"is:foo", events},
+		{"after:", events},
+	}
+
+	for _, td := range tests {
+		filters, _ := parseFilters(td.query)
+		if v := filterEvents(events, filters); !reflect.DeepEqual(v, td.x) {
+			t.Errorf("filterEvents(%q): Expected=%v, Got=%v", td.query, td.x, v)
+		}
+	}
+}
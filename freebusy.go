@@ -0,0 +1,112 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// interval is a period of time.
+type interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Duration returns the length of the interval.
+func (iv interval) Duration() time.Duration { return iv.End.Sub(iv.Start) }
+
+// String implements Stringer.
+func (iv interval) String() string {
+	return fmt.Sprintf("%s–%s", iv.Start.Format(time.RFC3339), iv.End.Format(time.RFC3339))
+}
+
+// mergeIntervals sorts intervals and joins any that overlap or touch.
+func mergeIntervals(ivs []interval) []interval {
+	if len(ivs) == 0 {
+		return nil
+	}
+
+	sorted := make([]interval, len(ivs))
+	copy(sorted, ivs)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+
+	merged := []interval{sorted[0]}
+	for _, iv := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if iv.Start.After(last.End) {
+			merged = append(merged, iv)
+			continue
+		}
+		if iv.End.After(last.End) {
+			last.End = iv.End
+		}
+	}
+
+	return merged
+}
+
+// freeIntervals returns the gaps between busy intervals within the period
+// start to end that are at least min long.
+func freeIntervals(busy []interval, start, end time.Time, min time.Duration) []interval {
+	var (
+		free   []interval
+		cursor = start
+	)
+
+	add := func(s, e time.Time) {
+		if e.Sub(s) >= min && e.After(s) {
+			free = append(free, interval{s, e})
+		}
+	}
+
+	for _, iv := range mergeIntervals(busy) {
+		if !iv.End.After(cursor) {
+			continue
+		}
+		if !iv.Start.Before(end) {
+			break
+		}
+		add(cursor, iv.Start)
+		cursor = iv.End
+	}
+
+	if cursor.Before(end) {
+		add(cursor, end)
+	}
+
+	return free
+}
+
+// busyDuration returns the total busy time between start and end.
+func busyDuration(busy []interval, start, end time.Time) time.Duration {
+	var d time.Duration
+	for _, iv := range mergeIntervals(busy) {
+		s, e := iv.Start, iv.End
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+		if e.After(s) {
+			d += e.Sub(s)
+		}
+	}
+	return d
+}
+
+// busyIntervals returns the times blocked by events. Events marked as free,
+// all-day events and declined invitations are ignored.
+func busyIntervals(events []*Event) []interval {
+	var busy []interval
+	for _, e := range events {
+		if e.AllDay || e.Free || e.Response == "declined" {
+			continue
+		}
+		busy = append(busy, interval{e.Start, e.End})
+	}
+	return busy
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFreeIntervals(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2019, 4, 3, h, m, 0, 0, time.UTC) }
+	iv := func(h1, m1, h2, m2 int) interval { return interval{at(h1, m1), at(h2, m2)} }
+
+	tests := []struct {
+		busy []interval
+		min  time.Duration
+		x    []interval
+	}{
+		{nil, time.Minute, []interval{iv(9, 0, 17, 0)}},
+		{[]interval{iv(10, 0, 11, 0)}, time.Minute, []interval{iv(9, 0, 10, 0), iv(11, 0, 17, 0)}},
+		// overlapping, touching and unsorted
+		{[]interval{iv(13, 0, 14, 0), iv(10, 0, 11, 0), iv(10, 30, 12, 0), iv(12, 0, 12, 30)},
+			time.Minute, []interval{iv(9, 0, 10, 0), iv(12, 30, 13, 0), iv(14, 0, 17, 0)}},
+		// gaps shorter than min are dropped
+		{[]interval{iv(10, 0, 11, 0), iv(11, 15, 16, 45)}, 30 * time.Minute,
+			[]interval{iv(9, 0, 10, 0)}},
+		// busy intervals extending beyond the period
+		{[]interval{iv(8, 0, 9, 30), iv(16, 0, 18, 0)}, time.Minute, []interval{iv(9, 30, 16, 0)}},
+		{[]interval{iv(7, 0, 8, 0), iv(18, 0, 19, 0)}, time.Minute, []interval{iv(9, 0, 17, 0)}},
+		{[]interval{iv(8, 0, 18, 0)}, time.Minute, nil},
+	}
+
+	for i, td := range tests {
+		v := freeIntervals(td.busy, at(9, 0), at(17, 0), td.min)
+		if !reflect.DeepEqual(v, td.x) {
+			t.Errorf("#%d: Expected=%v, Got=%v", i, td.x, v)
+		}
+	}
+}
+
+func TestBusyDuration(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2019, 4, 3, h, m, 0, 0, time.UTC) }
+	iv := func(h1, m1, h2, m2 int) interval { return interval{at(h1, m1), at(h2, m2)} }
+
+	tests := []struct {
+		busy []interval
+		x    time.Duration
+	}{
+		{nil, 0},
+		{[]interval{iv(10, 0, 11, 0)}, time.Hour},
+		{[]interval{iv(10, 0, 11, 0), iv(10, 30, 11, 30)}, 90 * time.Minute},
+		{[]interval{iv(7, 0, 9, 30), iv(16, 30, 19, 0)}, time.Hour},
+		{[]interval{iv(7, 0, 8, 0)}, 0},
+	}
+
+	for i, td := range tests {
+		if v := busyDuration(td.busy, at(9, 0), at(17, 0)); v != td.x {
+			t.Errorf("#%d: Expected=%v, Got=%v", i, td.x, v)
+		}
+	}
+}
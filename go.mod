@@ -11,6 +11,7 @@ require (
 	golang.org/x/sys v0.0.0-20200625212154-ddb9806d33ae // indirect
 	google.golang.org/api v0.29.0
 	google.golang.org/genproto v0.0.0-20200720141249-1244ee217b7e // indirect
+	howett.net/plist v0.0.0-20200419221736-3b63eb3a43b5
 )
 
 replace github.com/golang/lint => golang.org/x/lint v0.0.0-20190409202823-959b441ac422
@@ -0,0 +1,657 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// iCalendar date and date-time formats.
+const (
+	icalDate     = "20060102"
+	icalDateTime = "20060102T150405"
+	icalUTC      = "20060102T150405Z"
+)
+
+// icalProp is a property of an iCalendar component, e.g.
+// "DTSTART;TZID=Europe/Berlin:20190403T100000".
+type icalProp struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Param returns the value of the named parameter.
+func (p *icalProp) Param(name string) string { return p.Params[name] }
+
+// Text returns the unescaped value of a TEXT property.
+func (p *icalProp) Text() string { return icalUnescape(p.Value) }
+
+// Time parses a DATE or DATE-TIME property. Floating times and times in
+// unknown zones are assumed to be in loc. Dates are midnight in displayTZ.
+func (p *icalProp) Time(loc *time.Location) (t time.Time, allDay bool, err error) {
+	v := strings.TrimSpace(p.Value)
+
+	if p.Param("VALUE") == "DATE" || len(v) == len(icalDate) {
+		t, err = time.ParseInLocation(icalDate, v, displayTZ)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(v, "Z") {
+		t, err = time.Parse(icalUTC, v)
+		return t, false, err
+	}
+
+	if tzid := p.Param("TZID"); tzid != "" {
+		if l, err := loadZone(tzid); err == nil {
+			loc = l
+		}
+	}
+
+	t, err = time.ParseInLocation(icalDateTime, v, loc)
+	return t, false, err
+}
+
+// String returns the property as an unfolded content line.
+func (p *icalProp) String() string {
+	var line strings.Builder
+	line.WriteString(p.Name)
+
+	names := make([]string, 0, len(p.Params))
+	for k := range p.Params {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		// quotes aren't allowed in parameter values
+		v := strings.Replace(p.Params[k], `"`, "'", -1)
+		if strings.ContainsAny(v, ":;,") {
+			v = `"` + v + `"`
+		}
+		line.WriteString(";" + k + "=" + v)
+	}
+	line.WriteString(":" + p.Value)
+	return line.String()
+}
+
+// icalComponent is a component of an iCalendar object, e.g. VCALENDAR,
+// VEVENT or VALARM.
+type icalComponent struct {
+	Name       string
+	Props      []*icalProp
+	Components []*icalComponent
+}
+
+// Prop returns the first property called name or nil.
+func (c *icalComponent) Prop(name string) *icalProp {
+	for _, p := range c.Props {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// PropsNamed returns all properties called name.
+func (c *icalComponent) PropsNamed(name string) []*icalProp {
+	var props []*icalProp
+	for _, p := range c.Props {
+		if p.Name == name {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// Text returns the unescaped value of the first property called name.
+func (c *icalComponent) Text(name string) string {
+	if p := c.Prop(name); p != nil {
+		return p.Text()
+	}
+	return ""
+}
+
+// Set replaces all properties called name with one property.
+func (c *icalComponent) Set(name, value string, params map[string]string) {
+	c.Remove(name)
+	c.Props = append(c.Props, &icalProp{Name: name, Params: params, Value: value})
+}
+
+// SetText replaces all properties called name with a TEXT property.
+func (c *icalComponent) SetText(name, text string) { c.Set(name, icalEscape(text), nil) }
+
+// SetTime replaces all properties called name with a DATE (if allDay is
+// true) or UTC DATE-TIME property.
+func (c *icalComponent) SetTime(name string, t time.Time, allDay bool) {
+	if allDay {
+		c.Set(name, t.Format(icalDate), map[string]string{"VALUE": "DATE"})
+		return
+	}
+	c.Set(name, t.UTC().Format(icalUTC), nil)
+}
+
+// SetTimeIn replaces all properties called name with a DATE-TIME property
+// in time zone loc, which must be described by a VTIMEZONE.
+func (c *icalComponent) SetTimeIn(name string, t time.Time, loc *time.Location) {
+	c.Set(name, t.In(loc).Format(icalDateTime), map[string]string{"TZID": loc.String()})
+}
+
+// Remove deletes all properties called name.
+func (c *icalComponent) Remove(name string) {
+	props := c.Props[:0]
+	for _, p := range c.Props {
+		if p.Name != name {
+			props = append(props, p)
+		}
+	}
+	c.Props = props
+}
+
+// Children returns sub-components called name.
+func (c *icalComponent) Children(name string) []*icalComponent {
+	var comps []*icalComponent
+	for _, sub := range c.Components {
+		if sub.Name == name {
+			comps = append(comps, sub)
+		}
+	}
+	return comps
+}
+
+// String returns the component in iCalendar format.
+func (c *icalComponent) String() string {
+	var b strings.Builder
+	c.encode(&b)
+	return b.String()
+}
+
+func (c *icalComponent) encode(b *strings.Builder) {
+	icalFold(b, "BEGIN:"+c.Name)
+	for _, p := range c.Props {
+		icalFold(b, p.String())
+	}
+	for _, sub := range c.Components {
+		sub.encode(b)
+	}
+	icalFold(b, "END:"+c.Name)
+}
+
+// icalFold writes line to b, folded to 75 octets as per RFC 5545.
+func icalFold(b *strings.Builder, line string) {
+	// continuation lines lose an octet to the leading space
+	n := 75
+	for len(line) > n {
+		i := n
+		// don't split UTF-8 sequences
+		for i > 0 && line[i]&0xC0 == 0x80 {
+			i--
+		}
+		b.WriteString(line[:i] + "\r\n ")
+		line = line[i:]
+		n = 74
+	}
+	b.WriteString(line + "\r\n")
+}
+
+// parseICal reads an iCalendar object and returns its top-level component,
+// usually VCALENDAR.
+func parseICal(r io.Reader) (*icalComponent, error) {
+	var (
+		lines   []string
+		scanner = bufio.NewScanner(r)
+	)
+
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// unfold continuation lines
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "read iCalendar data")
+	}
+
+	var (
+		root  *icalComponent
+		stack []*icalComponent
+	)
+
+	for i, line := range lines {
+		p, err := parseContentLine(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", i+1)
+		}
+
+		switch p.Name {
+		case "BEGIN":
+			c := &icalComponent{Name: strings.ToUpper(p.Value)}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			} else if root == nil {
+				root = c
+			}
+			stack = append(stack, c)
+
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(p.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, p.Value)
+			}
+			stack = stack[:len(stack)-1]
+
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property outside component", i+1)
+			}
+			c := stack[len(stack)-1]
+			c.Props = append(c.Props, p)
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("no iCalendar data")
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unterminated component %s", stack[len(stack)-1].Name)
+	}
+
+	return root, nil
+}
+
+// parseContentLine parses an unfolded line like
+// `ATTENDEE;CN="Smith, Bob";PARTSTAT=ACCEPTED:mailto:bob@example.com`.
+func parseContentLine(line string) (*icalProp, error) {
+	var (
+		p      = &icalProp{Params: map[string]string{}}
+		quoted bool
+		start  int
+		key    string
+	)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '=' && p.Name != "" && key == "":
+			key = strings.ToUpper(line[start:i])
+			start = i + 1
+		case c == ';' || c == ':':
+			s := line[start:i]
+			if p.Name == "" {
+				p.Name = strings.ToUpper(s)
+			} else if key != "" {
+				p.Params[key] = strings.Trim(s, `"`)
+				key = ""
+			}
+			start = i + 1
+			if c == ':' {
+				p.Value = line[start:]
+				return p, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("invalid content line: %q", line)
+}
+
+var icalUnescaper = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+// icalUnescape decodes a TEXT value.
+func icalUnescape(s string) string { return icalUnescaper.Replace(s) }
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`)
+
+// icalEscape encodes s as a TEXT value.
+func icalEscape(s string) string { return icalEscaper.Replace(s) }
+
+var icalDurationRegex = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICalDuration parses a DURATION value like "PT15M", "-P1D" or "P1DT2H".
+func parseICalDuration(s string) (time.Duration, error) {
+	m := icalDurationRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return 0, fmt.Errorf("invalid duration: %q", s)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+
+	if m[1] == "-" {
+		d = -d
+	}
+
+	return d, nil
+}
+
+// icalDuration formats d as a DURATION value.
+func icalDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	return fmt.Sprintf("%sPT%dM", sign, int(d.Minutes()))
+}
+
+// iCalendar PARTSTAT values and the equivalent Google Calendar statuses.
+var partStats = map[string]string{
+	"NEEDS-ACTION": "needsAction",
+	"ACCEPTED":     "accepted",
+	"DECLINED":     "declined",
+	"TENTATIVE":    "tentative",
+}
+
+// attendeeProp converts an Attendee into an ATTENDEE property, or an
+// ORGANIZER property if it is the event's organiser.
+func attendeeProp(a *Attendee, organizer bool) *icalProp {
+	p := &icalProp{Name: "ATTENDEE", Params: map[string]string{}, Value: "mailto:" + a.Email}
+	if organizer {
+		p.Name = "ORGANIZER"
+	}
+	if a.Name != "" {
+		p.Params["CN"] = a.Name
+	}
+	if organizer {
+		return p
+	}
+
+	p.Params["ROLE"] = "REQ-PARTICIPANT"
+	if a.Optional {
+		p.Params["ROLE"] = "OPT-PARTICIPANT"
+	}
+	for k, v := range partStats {
+		if v == a.Response {
+			p.Params["PARTSTAT"] = k
+		}
+	}
+	return p
+}
+
+// valarm returns a VALARM that shows a reminder lead before an event.
+func valarm(title string, lead time.Duration) *icalComponent {
+	alarm := &icalComponent{Name: "VALARM"}
+	alarm.Set("ACTION", "DISPLAY", nil)
+	alarm.SetText("DESCRIPTION", title)
+	alarm.Set("TRIGGER", icalDuration(-lead), nil)
+	return alarm
+}
+
+// icalAttendee converts an ATTENDEE or ORGANIZER property. Attendees whose
+// email address is self are marked as the current user.
+func icalAttendee(p *icalProp, self string) *Attendee {
+	email := p.Value
+	if strings.HasPrefix(strings.ToLower(email), "mailto:") {
+		email = email[7:]
+	}
+
+	return &Attendee{
+		Name:      p.Param("CN"),
+		Email:     email,
+		Response:  partStats[strings.ToUpper(p.Param("PARTSTAT"))],
+		Optional:  p.Param("ROLE") == "OPT-PARTICIPANT",
+		Organizer: p.Name == "ORGANIZER",
+		Self:      self != "" && strings.EqualFold(email, self),
+	}
+}
+
+// eventFromVEvent converts a VEVENT component into an Event in calendar
+// cal. self is the email address of the user. The returned Event has no ID,
+// as that depends on where the event came from. Cancelled events are nil.
+func eventFromVEvent(v *icalComponent, cal *Calendar, self string) (*Event, error) {
+	if cancelled(v) {
+		return nil, nil
+	}
+
+	p := v.Prop("DTSTART")
+	if p == nil {
+		return nil, errors.New("event has no DTSTART")
+	}
+
+	start, allDay, err := p.Time(displayTZ)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse DTSTART")
+	}
+
+	e := &Event{
+		IcalUID:       v.Text("UID"),
+		Title:         v.Text("SUMMARY"),
+		Description:   v.Text("DESCRIPTION"),
+		URL:           v.Text("URL"),
+		Location:      v.Text("LOCATION"),
+		Start:         start,
+		AllDay:        allDay,
+		TimeZone:      p.Param("TZID"),
+		Free:          strings.EqualFold(v.Text("TRANSP"), "TRANSPARENT"),
+		Recurring:     v.Prop("RRULE") != nil || v.Prop("RDATE") != nil || v.Prop("RECURRENCE-ID") != nil,
+		Colour:        cal.Colour,
+		CalendarID:    cal.ID,
+		CalendarTitle: cal.Title,
+	}
+
+	if e.TimeZone == "" {
+		e.TimeZone = cal.TimeZone
+	}
+
+	switch {
+	case v.Prop("DTEND") != nil:
+		if e.End, _, err = v.Prop("DTEND").Time(start.Location()); err != nil {
+			return nil, errors.Wrap(err, "parse DTEND")
+		}
+	case v.Prop("DURATION") != nil:
+		d, err := parseICalDuration(v.Prop("DURATION").Value)
+		if err != nil {
+			return nil, err
+		}
+		e.End = start.Add(d)
+		if allDay {
+			e.End = start.AddDate(0, 0, int(d.Hours()/24))
+		}
+	case allDay:
+		e.End = start.AddDate(0, 0, 1)
+	default:
+		e.End = start
+	}
+
+	e.ConferenceURL = findConferenceURL(v.Text("X-GOOGLE-CONFERENCE"), e.Location, e.Description)
+
+	if p := v.Prop("ORGANIZER"); p != nil {
+		e.Organizer = icalAttendee(p, self)
+	}
+
+	for _, p := range v.PropsNamed("ATTENDEE") {
+		a := icalAttendee(p, self)
+		if a.Self {
+			e.Response = a.Response
+		}
+		e.Attendees = append(e.Attendees, a)
+	}
+
+	for _, alarm := range v.Children("VALARM") {
+		p := alarm.Prop("TRIGGER")
+		if p == nil || p.Param("VALUE") == "DATE-TIME" || !strings.EqualFold(alarm.Text("ACTION"), "DISPLAY") {
+			continue
+		}
+		d, err := parseICalDuration(p.Value)
+		if err != nil || d > 0 {
+			continue
+		}
+		e.Reminders = append(e.Reminders, -d)
+	}
+
+	return e, nil
+}
+
+// cancelled returns true if VEVENT v has been cancelled.
+func cancelled(v *icalComponent) bool {
+	return strings.EqualFold(v.Text("STATUS"), "CANCELLED")
+}
+
+// instanceID returns base, plus the RECURRENCE-ID of v if it is one
+// occurrence of a recurring event.
+func instanceID(base string, v *icalComponent) string {
+	p := v.Prop("RECURRENCE-ID")
+	if p == nil {
+		return base
+	}
+
+	t, allDay, err := p.Time(displayTZ)
+	if err != nil {
+		return base + "#" + p.Value
+	}
+	if allDay {
+		return base + "#" + t.Format(icalDate)
+	}
+	return base + "#" + t.UTC().Format(icalUTC)
+}
+
+// occurrenceKey formats the start of an occurrence like a RECURRENCE-ID.
+func occurrenceKey(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format(icalDate)
+	}
+	return t.UTC().Format(icalUTC)
+}
+
+// icalTimes parses a property that may contain several comma-separated
+// dates or times, e.g. EXDATE.
+func icalTimes(p *icalProp, loc *time.Location) []time.Time {
+	var times []time.Time
+	for _, s := range strings.Split(p.Value, ",") {
+		q := *p
+		q.Value = s
+		t, _, err := q.Time(loc)
+		if err != nil {
+			log.Printf("[ical] ERR: %s: %v", p.Name, err)
+			continue
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// expandVEvents converts the VEVENTs in an iCalendar object into Events in
+// cal that overlap the period start to end. Recurring events are expanded
+// using their RRULE, RDATEs and EXDATEs. baseID returns the ID of the event
+// or series with the given UID; the IDs of occurrences have their
+// RECURRENCE-ID appended (see instanceID).
+func expandVEvents(root *icalComponent, cal *Calendar, self string, start, end time.Time, baseID func(uid string) string) []*Event {
+	var (
+		events    []*Event
+		series    []*icalComponent
+		overrides = map[string]bool{} // IDs of modified occurrences
+	)
+
+	add := func(e *Event) {
+		if e.End.After(start) && e.Start.Before(end) {
+			events = append(events, e)
+		}
+	}
+
+	for _, v := range root.Children("VEVENT") {
+		if v.Prop("RECURRENCE-ID") == nil {
+			series = append(series, v)
+			continue
+		}
+
+		id := instanceID(baseID(v.Text("UID")), v)
+		overrides[id] = true
+
+		e, err := eventFromVEvent(v, cal, self)
+		if err != nil {
+			log.Printf("[ical] ERR: event %s: %v", id, err)
+			continue
+		}
+		if e != nil {
+			e.ID = id
+			add(e)
+		}
+	}
+
+	for _, v := range series {
+		e, err := eventFromVEvent(v, cal, self)
+		if err != nil {
+			log.Printf("[ical] ERR: event %q: %v", v.Text("UID"), err)
+			continue
+		}
+		if e == nil {
+			continue
+		}
+
+		id := baseID(e.IcalUID)
+		if v.Prop("RRULE") == nil && v.Prop("RDATE") == nil {
+			e.ID = id
+			add(e)
+			continue
+		}
+
+		times := []time.Time{e.Start}
+		if p := v.Prop("RRULE"); p != nil {
+			r, err := parseRRule(p.Value, e.Start.Location())
+			if err != nil {
+				log.Printf("[ical] ERR: event %q: %v", e.Title, err)
+			} else {
+				times = r.Between(e.Start, end)
+			}
+		}
+
+		for _, p := range v.PropsNamed("RDATE") {
+			times = append(times, icalTimes(p, e.Start.Location())...)
+		}
+
+		excluded := map[string]bool{}
+		for _, p := range v.PropsNamed("EXDATE") {
+			for _, t := range icalTimes(p, e.Start.Location()) {
+				excluded[occurrenceKey(t, e.AllDay)] = true
+			}
+		}
+
+		var (
+			d    = e.End.Sub(e.Start)
+			days = int(e.End.Sub(e.Start).Hours()+12) / 24 // all-day events may span a DST change
+		)
+
+		for _, t := range times {
+			key := occurrenceKey(t, e.AllDay)
+			occ := *e
+			occ.ID = id + "#" + key
+			if excluded[key] || overrides[occ.ID] {
+				continue
+			}
+			excluded[key] = true // RDATEs may repeat RRULE occurrences
+
+			occ.Start, occ.End = t, t.Add(d)
+			if e.AllDay {
+				occ.End = t.AddDate(0, 0, days)
+			}
+			add(&occ)
+		}
+	}
+
+	return events
+}
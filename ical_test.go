@@ -0,0 +1,161 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:abc123\r\n" +
+	"SUMMARY:Planning\\, Q3\r\n" +
+	"DESCRIPTION:Agenda:\\n1. Budget\\n2. https://zoom.us/j/12345\r\n" +
+	"LOCATION:Room 1\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20190403T100000\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"ORGANIZER;CN=Alice:mailto:alice@example.com\r\n" +
+	"ATTENDEE;CN=\"Smith, Bob\";PARTSTAT=ACCEPTED:mailto:bob@example.com\r\n" +
+	"ATTENDEE;PARTSTAT=TENTATIVE;ROLE=OPT-PARTICIPANT:mailto:me@example.c\r\n" +
+	" om\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday\r\n" +
+	"SUMMARY:Holiday\r\n" +
+	"DTSTART;VALUE=DATE:20190405\r\n" +
+	"DTEND;VALUE=DATE:20190408\r\n" +
+	"TRANSP:TRANSPARENT\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICal(t *testing.T) {
+	root, err := parseICal(strings.NewReader(testICS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vevents := root.Children("VEVENT")
+	if len(vevents) != 2 {
+		t.Fatalf("Expected 2 VEVENTs, got %d", len(vevents))
+	}
+
+	var (
+		cal    = &Calendar{ID: "cal", Title: "Work", Colour: "#ff0000"}
+		berlin = time.FixedZone("CEST", 2*3600)
+	)
+
+	e, err := eventFromVEvent(vevents[0], cal, "me@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Title != "Planning, Q3" {
+		t.Errorf("Bad title. Expected=%q, Got=%q", "Planning, Q3", e.Title)
+	}
+	if x := "Agenda:\n1. Budget\n2. https://zoom.us/j/12345"; e.Description != x {
+		t.Errorf("Bad description. Expected=%q, Got=%q", x, e.Description)
+	}
+	if x := time.Date(2019, 4, 3, 10, 0, 0, 0, berlin); !e.Start.Equal(x) {
+		t.Errorf("Bad start. Expected=%v, Got=%v", x, e.Start)
+	}
+	if e.Duration() != 90*time.Minute {
+		t.Errorf("Bad duration. Expected=%v, Got=%v", 90*time.Minute, e.Duration())
+	}
+	if e.TimeZone != "Europe/Berlin" {
+		t.Errorf("Bad time zone. Expected=%q, Got=%q", "Europe/Berlin", e.TimeZone)
+	}
+	if e.ConferenceURL != "https://zoom.us/j/12345" {
+		t.Errorf("Bad conference URL: %q", e.ConferenceURL)
+	}
+	if e.Organizer == nil || e.Organizer.Name != "Alice" || e.Organizer.Email != "alice@example.com" {
+		t.Errorf("Bad organiser: %+v", e.Organizer)
+	}
+	if len(e.Attendees) != 2 || e.Attendees[0].Name != "Smith, Bob" || e.Attendees[0].Response != "accepted" {
+		t.Errorf("Bad attendees: %+v", e.Attendees)
+	}
+	if !e.Attendees[1].Self || !e.Attendees[1].Optional || e.Response != "tentative" {
+		t.Errorf("Bad self attendee: %+v", e.Attendees[1])
+	}
+	if !reflect.DeepEqual(e.Reminders, []time.Duration{15 * time.Minute}) {
+		t.Errorf("Bad reminders: %v", e.Reminders)
+	}
+
+	e, err = eventFromVEvent(vevents[1], cal, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.AllDay || !e.Free || len(e.Days()) != 3 || e.Reminders != nil {
+		t.Errorf("Bad all-day event: %+v", e)
+	}
+}
+
+func TestICalRoundTrip(t *testing.T) {
+	root, err := parseICal(strings.NewReader(testICS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := root.Children("VEVENT")[0]
+	v.SetText("SUMMARY", strings.Repeat("Long; title, ", 10))
+
+	root2, err := parseICal(strings.NewReader(root.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(root.String(), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line not folded: %q", line)
+		}
+	}
+
+	v2 := root2.Children("VEVENT")[0]
+	if v2.Text("SUMMARY") != v.Text("SUMMARY") {
+		t.Errorf("Bad summary. Expected=%q, Got=%q", v.Text("SUMMARY"), v2.Text("SUMMARY"))
+	}
+	if p := v2.PropsNamed("ATTENDEE")[0]; p.Param("CN") != "Smith, Bob" {
+		t.Errorf("Bad CN: %q", p.Param("CN"))
+	}
+}
+
+func TestParseICalDuration(t *testing.T) {
+	tests := []struct {
+		in string
+		x  time.Duration
+		ok bool
+	}{
+		{"PT15M", 15 * time.Minute, true},
+		{"-PT1H30M", -90 * time.Minute, true},
+		{"P1D", 24 * time.Hour, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"P2W", 14 * 24 * time.Hour, true},
+		{"+PT30S", 30 * time.Second, true},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"15M", 0, false},
+	}
+
+	for _, td := range tests {
+		v, err := parseICalDuration(td.in)
+		if td.ok && err != nil {
+			t.Errorf("parseICalDuration(%q): %v", td.in, err)
+			continue
+		}
+		if !td.ok && err == nil {
+			t.Errorf("parseICalDuration(%q): accepted invalid duration", td.in)
+			continue
+		}
+		if v != td.x {
+			t.Errorf("parseICalDuration(%q): Expected=%v, Got=%v", td.in, td.x, v)
+		}
+	}
+}
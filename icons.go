@@ -47,6 +47,7 @@ var (
 	iconNext            = &aw.Icon{Value: "icons/next.png"}
 	iconPrevious        = &aw.Icon{Value: "icons/previous.png"}
 	iconLoading         = &aw.Icon{Value: "icons/loading.png"}
+	iconURL             = &aw.Icon{Value: "icons/url.png"}
 	iconUpdateOK        = &aw.Icon{Value: "icons/update-ok.png"}
 	iconUpdateAvailable = &aw.Icon{Value: "icons/update-available.png"}
 	iconWarning         = &aw.Icon{Value: "icons/warning.png"}
@@ -0,0 +1,172 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/calendar/v3"
+)
+
+// loadICalFile reads the iCalendar file at path.
+func loadICalFile(path string) (*icalComponent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file")
+	}
+	defer f.Close()
+
+	root, err := parseICal(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse %s", path)
+	}
+
+	if root.Name != "VCALENDAR" {
+		return nil, fmt.Errorf("%s is not an iCalendar file", path)
+	}
+
+	if err := resolveZones(root); err != nil {
+		return nil, errors.Wrapf(err, "read %s", path)
+	}
+
+	return root, nil
+}
+
+// splitEvents splits an iCalendar object into one VCALENDAR per event.
+// Each contains the VEVENTs with the same UID (the event first, followed
+// by modified occurrences) and all time zones.
+func splitEvents(root *icalComponent) []*icalComponent {
+	var (
+		zones  = root.Children("VTIMEZONE")
+		byUID  = map[string]*icalComponent{}
+		events []*icalComponent
+	)
+
+	for _, v := range root.Children("VEVENT") {
+		uid := v.Text("UID")
+		vc, ok := byUID[uid]
+		if !ok || uid == "" {
+			vc = &icalComponent{Name: "VCALENDAR"}
+			vc.Set("VERSION", "2.0", nil)
+			vc.Set("PRODID", icalProdID, nil)
+			vc.Components = append(vc.Components, zones...)
+			byUID[uid] = vc
+			events = append(events, vc)
+		}
+		vc.Components = append(vc.Components, v)
+	}
+
+	for _, vc := range events {
+		vevents := vc.Components[len(zones):]
+		sort.SliceStable(vevents, func(i, j int) bool {
+			return vevents[i].Prop("RECURRENCE-ID") == nil && vevents[j].Prop("RECURRENCE-ID") != nil
+		})
+	}
+
+	return events
+}
+
+// conflicts returns the events in existing that overlap e. As with free
+// slots, events marked as free, all-day events and declined invitations
+// don't conflict, nor do other copies of e.
+func conflicts(e *Event, existing []*Event) []*Event {
+	var found []*Event
+	if e.AllDay || e.Free {
+		return found
+	}
+
+	for _, e2 := range existing {
+		if e2.AllDay || e2.Free || e2.Response == "declined" || (e.IcalUID != "" && e2.IcalUID == e.IcalUID) {
+			continue
+		}
+		if e2.End.After(e.Start) && e2.Start.Before(e.End) {
+			found = append(found, e2)
+		}
+	}
+
+	return found
+}
+
+// googleEvent converts a VEVENT into a Calendar API event for importing.
+// It returns nil if the event is cancelled.
+func googleEvent(v *icalComponent, cal *Calendar, self string) (*calendar.Event, error) {
+	e, err := eventFromVEvent(v, cal, self)
+	if err != nil || e == nil {
+		return nil, err
+	}
+
+	// the API only understands IANA zones
+	tz := cal.TimeZone
+	if loc, err := loadZone(e.TimeZone); err == nil {
+		tz = loc.String()
+	}
+
+	ev := &calendar.Event{
+		ICalUID:     e.IcalUID,
+		Summary:     e.Title,
+		Description: e.Description,
+		Location:    e.Location,
+		Start:       &calendar.EventDateTime{TimeZone: tz},
+		End:         &calendar.EventDateTime{TimeZone: tz},
+	}
+
+	if e.AllDay {
+		ev.Start.Date = e.Start.Format(timeFormat)
+		ev.End.Date = e.End.Format(timeFormat)
+	} else {
+		ev.Start.DateTime = e.Start.Format(time.RFC3339)
+		ev.End.DateTime = e.End.Format(time.RFC3339)
+	}
+
+	if e.Free {
+		ev.Transparency = "transparent"
+	}
+
+	if a := e.Organizer; a != nil {
+		ev.Organizer = &calendar.EventOrganizer{Email: a.Email, DisplayName: a.Name}
+	}
+
+	for _, a := range e.Attendees {
+		ev.Attendees = append(ev.Attendees, &calendar.EventAttendee{
+			Email:          a.Email,
+			DisplayName:    a.Name,
+			ResponseStatus: a.Response,
+			Optional:       a.Optional,
+		})
+	}
+
+	if e.Reminders != nil {
+		ev.Reminders = &calendar.EventReminders{ForceSendFields: []string{"UseDefault"}}
+		for _, d := range e.Reminders {
+			ev.Reminders.Overrides = append(ev.Reminders.Overrides,
+				&calendar.EventReminder{Method: "popup", Minutes: int64(d.Minutes())})
+		}
+	}
+
+	for _, name := range []string{"RRULE", "RDATE", "EXDATE"} {
+		for _, p := range v.PropsNamed(name) {
+			ev.Recurrence = append(ev.Recurrence, p.String())
+		}
+	}
+
+	// modified occurrence of a recurring event
+	if p := v.Prop("RECURRENCE-ID"); p != nil {
+		t, allDay, err := p.Time(e.Start.Location())
+		if err != nil {
+			return nil, errors.Wrap(err, "parse RECURRENCE-ID")
+		}
+		ev.OriginalStartTime = &calendar.EventDateTime{TimeZone: tz}
+		if allDay {
+			ev.OriginalStartTime.Date = t.Format(timeFormat)
+		} else {
+			ev.OriginalStartTime.DateTime = t.Format(time.RFC3339)
+		}
+	}
+
+	return ev, nil
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testImportICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Europe/Berlin\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup\r\n" +
+	"RECURRENCE-ID;TZID=Europe/Berlin:20190402T090000\r\n" +
+	"SUMMARY:Late Standup\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20190402T110000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20190402T111500\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup\r\n" +
+	"SUMMARY:Standup\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20190401T090000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20190401T091500\r\n" +
+	"RRULE:FREQ=DAILY;COUNT=5\r\n" +
+	"EXDATE;TZID=Europe/Berlin:20190403T090000\r\n" +
+	"TRANSP:TRANSPARENT\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:review\r\n" +
+	"SUMMARY:Review\r\n" +
+	"DTSTART:20190404T130000Z\r\n" +
+	"DTEND:20190404T140000Z\r\n" +
+	"ATTENDEE;PARTSTAT=ACCEPTED:mailto:bob@example.com\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"TRIGGER:-PT10M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestSplitEvents(t *testing.T) {
+	root, err := parseICal(strings.NewReader(testImportICS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := splitEvents(root)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	for i, x := range []struct {
+		uid     string
+		vevents int
+	}{
+		{"standup", 2},
+		{"review", 1},
+	} {
+		vc := events[i]
+		if n := len(vc.Children("VTIMEZONE")); n != 1 {
+			t.Errorf("#%d: Expected 1 VTIMEZONE, got %d", i, n)
+		}
+		vevents := vc.Children("VEVENT")
+		if len(vevents) != x.vevents {
+			t.Fatalf("#%d: Expected %d VEVENTs, got %d", i, x.vevents, len(vevents))
+		}
+		for _, v := range vevents {
+			if s := v.Text("UID"); s != x.uid {
+				t.Errorf("#%d: Bad UID. Expected=%q, Got=%q", i, x.uid, s)
+			}
+		}
+		// series must come before its modified occurrences
+		if vevents[0].Prop("RECURRENCE-ID") != nil {
+			t.Errorf("#%d: Modified occurrence is first", i)
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	var (
+		start = time.Date(2019, 4, 4, 13, 0, 0, 0, time.UTC)
+		e     = &Event{IcalUID: "review", Start: start, End: start.Add(time.Hour)}
+	)
+
+	existing := []*Event{
+		{Title: "Overlaps", Start: start.Add(-30 * time.Minute), End: start.Add(30 * time.Minute)},
+		{Title: "Adjacent", Start: start.Add(time.Hour), End: start.Add(2 * time.Hour)},
+		{Title: "Free", Start: start, End: start.Add(time.Hour), Free: true},
+		{Title: "Declined", Start: start, End: start.Add(time.Hour), Response: "declined"},
+		{Title: "All Day", Start: midnight(start), End: midnight(start).AddDate(0, 0, 1), AllDay: true},
+		{Title: "Same Event", IcalUID: "review", Start: start, End: start.Add(time.Hour)},
+	}
+
+	found := conflicts(e, existing)
+	if len(found) != 1 || found[0].Title != "Overlaps" {
+		t.Errorf("Bad conflicts: %v", found)
+	}
+
+	e.Free = true
+	if found := conflicts(e, existing); len(found) != 0 {
+		t.Errorf("Free event has conflicts: %v", found)
+	}
+}
+
+func TestGoogleEvent(t *testing.T) {
+	root, err := parseICal(strings.NewReader(testImportICS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		cal    = &Calendar{ID: "cal", TimeZone: "Europe/London"}
+		series = splitEvents(root)[0].Children("VEVENT")
+	)
+
+	ev, err := googleEvent(series[0], cal, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.ICalUID != "standup" || ev.Start.TimeZone != "Europe/Berlin" || ev.Transparency != "transparent" {
+		t.Errorf("Bad event: %+v", ev)
+	}
+	if ev.Start.DateTime != "2019-04-01T09:00:00+02:00" {
+		t.Errorf("Bad start: %q", ev.Start.DateTime)
+	}
+	if len(ev.Recurrence) != 2 || ev.Recurrence[0] != "RRULE:FREQ=DAILY;COUNT=5" ||
+		!strings.HasPrefix(ev.Recurrence[1], "EXDATE;TZID=Europe/Berlin:") {
+		t.Errorf("Bad recurrence: %q", ev.Recurrence)
+	}
+
+	ev, err = googleEvent(series[1], cal, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.OriginalStartTime == nil || ev.OriginalStartTime.DateTime != "2019-04-02T09:00:00+02:00" {
+		t.Errorf("Bad original start: %+v", ev.OriginalStartTime)
+	}
+
+	review := splitEvents(root)[1].Children("VEVENT")[0]
+	if ev, err = googleEvent(review, cal, ""); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Start.TimeZone != "Europe/London" || ev.Start.DateTime != "2019-04-04T13:00:00Z" {
+		t.Errorf("Bad start: %+v", ev.Start)
+	}
+	if len(ev.Attendees) != 1 || ev.Attendees[0].ResponseStatus != "accepted" {
+		t.Errorf("Bad attendees: %+v", ev.Attendees)
+	}
+	if ev.Reminders == nil || len(ev.Reminders.Overrides) != 1 || ev.Reminders.Overrides[0].Minutes != 10 {
+		t.Errorf("Bad reminders: %+v", ev.Reminders)
+	}
+}
+
+func TestCalDAVImport(t *testing.T) {
+	fake := newFakeCalDAV()
+	fake.objects = map[string]string{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	root, err := parseICal(strings.NewReader(testImportICS))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		p   = newCalDAVProvider(srv.URL+"/", "alice@example.com", "pw", "test", srv.Client())
+		cal = &Calendar{ID: srv.URL + "/cal/work/", Title: "Work"}
+	)
+
+	// importing again updates the events instead of duplicating them
+	for i := 0; i < 2; i++ {
+		for _, vc := range splitEvents(root) {
+			if err := p.ImportEvent(cal, vc); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if len(fake.objects) != 2 {
+		t.Errorf("Expected 2 events on server, found %d", len(fake.objects))
+	}
+
+	events, err := p.Events(cal, time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2019, 4, 8, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 5 standups, less 1 exception, plus the review
+	if len(events) != 5 {
+		t.Errorf("Expected 5 events, got %d", len(events))
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Locale contains the names and date formats of a language/region.
+type Locale struct {
+	Code        string
+	Days        [7]string // Sunday first, like time.Weekday
+	ShortDays   [7]string
+	Months      [12]string
+	ShortMonths [12]string
+
+	// Layouts for time.Format. English weekday and month names
+	// (Monday, Mon, January, Jan) are replaced with the above.
+	LongDate   string // e.g. Monday, 2 January 2006
+	MediumDate string // e.g. Monday, 2 Jan 2006
+	ShortDate  string // e.g. Mon 2 Jan
+
+	Today     string
+	Tomorrow  string
+	Yesterday string
+	InDays    [2]string // singular and plural of "in %d day(s)"
+	DaysAgo   [2]string // singular and plural of "%d day(s) ago"
+}
+
+// Placeholders for names in layouts. They must not contain anything
+// time.Format interprets.
+const (
+	phDay        = "\x01"
+	phShortDay   = "\x02"
+	phMonth      = "\x03"
+	phShortMonth = "\x04"
+)
+
+// Format formats t according to layout with names in Locale's language.
+func (l *Locale) Format(t time.Time, layout string) string {
+	r := strings.NewReplacer("Monday", phDay, "Mon", phShortDay, "January", phMonth, "Jan", phShortMonth)
+	s := t.Format(r.Replace(layout))
+
+	return strings.NewReplacer(
+		phDay, l.Days[t.Weekday()],
+		phShortDay, l.ShortDays[t.Weekday()],
+		phMonth, l.Months[t.Month()-1],
+		phShortMonth, l.ShortMonths[t.Month()-1],
+	).Replace(s)
+}
+
+// Long formats t with Locale's LongDate layout.
+func (l *Locale) Long(t time.Time) string { return l.Format(t, l.LongDate) }
+
+// Medium formats t with Locale's MediumDate layout.
+func (l *Locale) Medium(t time.Time) string { return l.Format(t, l.MediumDate) }
+
+// Short formats t with Locale's ShortDate layout.
+func (l *Locale) Short(t time.Time) string { return l.Format(t, l.ShortDate) }
+
+// Weekday returns the name of t's day of the week.
+func (l *Locale) Weekday(t time.Time) string { return l.Days[t.Weekday()] }
+
+// RelativeDays returns "in n days" for positive n and "n days ago" for
+// negative n.
+func (l *Locale) RelativeDays(n int) string {
+	phrases := l.InDays
+	if n < 0 {
+		phrases = l.DaysAgo
+		n = -n
+	}
+
+	if n == 1 {
+		return fmt.Sprintf(phrases[0], n)
+	}
+	return fmt.Sprintf(phrases[1], n)
+}
+
+var (
+	// Locale used for display. Set by LOCALE.
+	locale = locales["en_GB"]
+
+	locales = map[string]*Locale{
+		"en_GB": {
+			Code:        "en_GB",
+			Days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+			ShortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+			Months:      [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+			ShortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+			LongDate:    "Monday, 2 January 2006",
+			MediumDate:  "Monday, 2 Jan 2006",
+			ShortDate:   "Mon 2 Jan",
+			Today:       "Today",
+			Tomorrow:    "Tomorrow",
+			Yesterday:   "Yesterday",
+			InDays:      [2]string{"in %d day", "in %d days"},
+			DaysAgo:     [2]string{"%d day ago", "%d days ago"},
+		},
+		"en_US": {
+			Code:        "en_US",
+			Days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+			ShortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+			Months:      [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+			ShortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+			LongDate:    "Monday, January 2, 2006",
+			MediumDate:  "Monday, Jan 2, 2006",
+			ShortDate:   "Mon Jan 2",
+			Today:       "Today",
+			Tomorrow:    "Tomorrow",
+			Yesterday:   "Yesterday",
+			InDays:      [2]string{"in %d day", "in %d days"},
+			DaysAgo:     [2]string{"%d day ago", "%d days ago"},
+		},
+		"de_DE": {
+			Code:        "de_DE",
+			Days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+			ShortDays:   [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+			Months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+			ShortMonths: [12]string{"Jan", "Feb", "Mär", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+			LongDate:    "Monday, 2. January 2006",
+			MediumDate:  "Monday, 2. Jan 2006",
+			ShortDate:   "Mon 2. Jan",
+			Today:       "Heute",
+			Tomorrow:    "Morgen",
+			Yesterday:   "Gestern",
+			InDays:      [2]string{"in %d Tag", "in %d Tagen"},
+			DaysAgo:     [2]string{"vor %d Tag", "vor %d Tagen"},
+		},
+		"fr_FR": {
+			Code:        "fr_FR",
+			Days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+			ShortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+			Months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+			ShortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+			LongDate:    "Monday 2 January 2006",
+			MediumDate:  "Monday 2 Jan 2006",
+			ShortDate:   "Mon 2 Jan",
+			Today:       "Aujourd'hui",
+			Tomorrow:    "Demain",
+			Yesterday:   "Hier",
+			InDays:      [2]string{"dans %d jour", "dans %d jours"},
+			DaysAgo:     [2]string{"il y a %d jour", "il y a %d jours"},
+		},
+		"es_ES": {
+			Code:        "es_ES",
+			Days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+			ShortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+			Months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+			ShortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+			LongDate:    "Monday, 2 de January de 2006",
+			MediumDate:  "Monday, 2 Jan 2006",
+			ShortDate:   "Mon 2 Jan",
+			Today:       "Hoy",
+			Tomorrow:    "Mañana",
+			Yesterday:   "Ayer",
+			InDays:      [2]string{"dentro de %d día", "dentro de %d días"},
+			DaysAgo:     [2]string{"hace %d día", "hace %d días"},
+		},
+		"it_IT": {
+			Code:        "it_IT",
+			Days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+			ShortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+			Months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+			ShortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+			LongDate:    "Monday 2 January 2006",
+			MediumDate:  "Monday 2 Jan 2006",
+			ShortDate:   "Mon 2 Jan",
+			Today:       "Oggi",
+			Tomorrow:    "Domani",
+			Yesterday:   "Ieri",
+			InDays:      [2]string{"tra %d giorno", "tra %d giorni"},
+			DaysAgo:     [2]string{"%d giorno fa", "%d giorni fa"},
+		},
+		"nl_NL": {
+			Code:        "nl_NL",
+			Days:        [7]string{"zondag", "maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag"},
+			ShortDays:   [7]string{"zo", "ma", "di", "wo", "do", "vr", "za"},
+			Months:      [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+			ShortMonths: [12]string{"jan", "feb", "mrt", "apr", "mei", "jun", "jul", "aug", "sep", "okt", "nov", "dec"},
+			LongDate:    "Monday 2 January 2006",
+			MediumDate:  "Monday 2 Jan 2006",
+			ShortDate:   "Mon 2 Jan",
+			Today:       "Vandaag",
+			Tomorrow:    "Morgen",
+			Yesterday:   "Gisteren",
+			InDays:      [2]string{"over %d dag", "over %d dagen"},
+			DaysAgo:     [2]string{"%d dag geleden", "%d dagen geleden"},
+		},
+	}
+)
+
+// lookupLocale returns the Locale for a code like "de_DE", "de-DE",
+// "de_DE.UTF-8" or "de". If there's no such locale, en_GB is returned.
+func lookupLocale(code string) *Locale {
+	if i := strings.Index(code, "."); i > -1 {
+		code = code[:i]
+	}
+	code = strings.Replace(code, "-", "_", -1)
+
+	if l, ok := locales[code]; ok {
+		return l
+	}
+
+	// match language only
+	lang := strings.ToLower(strings.Split(code, "_")[0])
+	for _, c := range []string{"en_GB", "en_US", "de_DE", "fr_FR", "es_ES", "it_IT", "nl_NL"} {
+		if strings.HasPrefix(c, lang+"_") {
+			return locales[c]
+		}
+	}
+
+	if code != "" {
+		log.Printf("[locale] unknown locale %q, using en_GB", code)
+	}
+
+	return locales["en_GB"]
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocale(t *testing.T) {
+	// Wednesday
+	tm := time.Date(2019, 3, 6, 14, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		code            string
+		long, med, shrt string
+		today, in, ago  string
+	}{
+		{"en_GB", "Wednesday, 6 March 2019", "Wednesday, 6 Mar 2019", "Wed 6 Mar",
+			"Today", "in 3 days", "1 day ago"},
+		{"en_US", "Wednesday, March 6, 2019", "Wednesday, Mar 6, 2019", "Wed Mar 6",
+			"Today", "in 3 days", "1 day ago"},
+		{"de_DE", "Mittwoch, 6. März 2019", "Mittwoch, 6. Mär 2019", "Mi 6. Mär",
+			"Heute", "in 3 Tagen", "vor 1 Tag"},
+		{"fr_FR", "mercredi 6 mars 2019", "mercredi 6 mars 2019", "mer. 6 mars",
+			"Aujourd'hui", "dans 3 jours", "il y a 1 jour"},
+		{"es_ES", "miércoles, 6 de marzo de 2019", "miércoles, 6 mar 2019", "mié 6 mar",
+			"Hoy", "dentro de 3 días", "hace 1 día"},
+		{"it_IT", "mercoledì 6 marzo 2019", "mercoledì 6 mar 2019", "mer 6 mar",
+			"Oggi", "tra 3 giorni", "1 giorno fa"},
+		{"nl_NL", "woensdag 6 maart 2019", "woensdag 6 mrt 2019", "wo 6 mrt",
+			"Vandaag", "over 3 dagen", "1 dag geleden"},
+	}
+
+	for _, td := range tests {
+		l := lookupLocale(td.code)
+		if l.Code != td.code {
+			t.Errorf("lookup %q: got %q", td.code, l.Code)
+			continue
+		}
+		if v := l.Long(tm); v != td.long {
+			t.Errorf("%s: bad long date. Expected=%q, Got=%q", td.code, td.long, v)
+		}
+		if v := l.Medium(tm); v != td.med {
+			t.Errorf("%s: bad medium date. Expected=%q, Got=%q", td.code, td.med, v)
+		}
+		if v := l.Short(tm); v != td.shrt {
+			t.Errorf("%s: bad short date. Expected=%q, Got=%q", td.code, td.shrt, v)
+		}
+		if l.Today != td.today {
+			t.Errorf("%s: bad today. Expected=%q, Got=%q", td.code, td.today, l.Today)
+		}
+		if v := l.RelativeDays(3); v != td.in {
+			t.Errorf("%s: bad future. Expected=%q, Got=%q", td.code, td.in, v)
+		}
+		if v := l.RelativeDays(-1); v != td.ago {
+			t.Errorf("%s: bad past. Expected=%q, Got=%q", td.code, td.ago, v)
+		}
+	}
+}
+
+func TestLookupLocale(t *testing.T) {
+	tests := []struct {
+		in, x string
+	}{
+		{"", "en_GB"},
+		{"de_DE", "de_DE"},
+		{"de-DE", "de_DE"},
+		{"de_AT.UTF-8", "de_DE"},
+		{"fr", "fr_FR"},
+		{"en_US", "en_US"},
+		{"en_AU", "en_GB"},
+		{"xx_XX", "en_GB"},
+	}
+
+	for _, td := range tests {
+		if v := lookupLocale(td.in).Code; v != td.x {
+			t.Errorf("Bad locale for %q. Expected=%q, Got=%q", td.in, td.x, v)
+		}
+	}
+}
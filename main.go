@@ -10,10 +10,12 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	aw "github.com/deanishe/awgo"
@@ -24,8 +26,7 @@ import (
 )
 
 const (
-	timeFormat     = "2006-01-02"
-	timeFormatLong = "Monday, 2 January 2006"
+	timeFormat = "2006-01-02"
 
 	// Workflow icon colours
 	yellow = "f8ac30"
@@ -44,14 +45,26 @@ const usage = `
 gcal [<command>] [options] [<query>]
 
 Usage:
-    gcal dates [--] [<format>]
-    gcal events [--date=<date>] [--] [<query>]
-    gcal calendars [<query>]
-    gcal active [<query>]
+    gcal dates [--format=<format>] [--] [<format>]
+    gcal events [--date=<date>] [--format=<format>] [--] [<query>]
+    gcal next [--format=<format>]
+    gcal free [<duration>] [<date>]
+    gcal meet [<attendee>...]
+    gcal week [--format=<format>] [<date>]
+    gcal month [--format=<format>] [<date>]
+    gcal search [--format=<format>] [<query>]
+    gcal calendars [--format=<format>] [<query>]
+    gcal active [--format=<format>] [<query>]
     gcal toggle <calID>
     gcal set <key> <value>
-    gcal update (workflow|calendars|events) [<date>]
+    gcal update (workflow|calendars|events)
+    gcal update search <query>
+    gcal update meet [--] <attendee>...
+    gcal daemon
     gcal config [<query>]
+    gcal caldav <account> <url> <username>
+    gcal subscribe <url> [<name>]
+    gcal unsubscribe <url>
     gcal logout <account>
     gcal reauth <account>
     gcal clear
@@ -59,12 +72,32 @@ Usage:
     gcal server
     gcal reload
     gcal create <quick> <calID>
+    gcal rsvp <eventID> <calID> (yes|no|maybe)
+    gcal edit <calID> <eventID> [--] [<query>]
+    gcal move <calID> <eventID> [--] [<query>]
+    gcal patch <calID> <eventID> <key> <value>
+    gcal delete [--confirm] [--notify] <calID> <eventID>
+    gcal undo [--confirm]
+    gcal export [--from=<date>] [--to=<date>] [--calendar=<cal>...] [--format=<format>] [--output=<file>]
+    gcal export <calID> <eventID>
+    gcal import [--confirm] <file> [<calID>]
     gcal -h
 
 Options:
     -a --app <app>     Application to open URLs in.
+    --calendar <cal>   Title or ID of calendar to export (default is
+                       active calendars).
+    --confirm          Perform action without asking first.
     -d --date <date>   Date to show events for (format YYYY-MM-DD).
+    --format <format>  Output format: "alfred" (the default), "json",
+                       "tsv" or "text". export also accepts "ics"
+                       (its default).
+    --from <date>      First day to export (default today).
     -h --help          Show this message and exit.
+    --notify           Email guests about the change.
+    -o --output <file> File to export to (default is STDOUT).
+    --to <date>        Last day to export (default is SCHEDULE_DAYS
+                       after --from).
     --version          Show workflow version and exit.
 `
 
@@ -85,41 +118,88 @@ var (
 type options struct {
 	// commands
 	Calendars bool
+	Caldav    bool
 	Active    bool
 	Clear     bool
 	Config    bool
+	Daemon    bool
 	Dates     bool
+	Delete    bool
+	Edit      bool
 	Events    bool
+	Export    bool
+	Import    bool
 	Logout    bool
+	Move      bool
+	Next      bool
+	Free      bool
+	Meet      bool
+	Month     bool
 	Reauth    bool
 	Open      bool
+	Patch     bool
 	Reload    bool
+	Search    bool
 	Server    bool
 	Set       bool
+	Subscribe bool
 	Toggle    bool
+	Undo      bool
+	Unsub     bool `docopt:"unsubscribe"`
 	Update    bool
+	Week      bool
 	Create    bool
+	Rsvp      bool
 
 	// sub-commands
 	Workflow bool
+	Yes      bool
+	No       bool
+	Maybe    bool
 
 	// flags
+	Confirm    bool
+	Notify     bool
 	Account    string
 	App        string
 	CalendarID string `docopt:"<calID>"`
+	EventID    string `docopt:"<eventID>"`
 	Date       string `docopt:"<date>,--date"`
 	DateFormat string `docopt:"<format>"`
 	Query      string
 	URL        string `docopt:"<url>"`
+	Name       string `docopt:"<name>"`
+	From       string `docopt:"--from"`
+	To         string `docopt:"--to"`
+	Format     string `docopt:"--format"`
+	Output     string `docopt:"--output"`
+	File       string `docopt:"<file>"`
+	Username   string `docopt:"<username>"`
 	Key        string
 	Value      string
-	Quick      string `docopt:"<quick>"`
+	Quick      string   `docopt:"<quick>"`
+	Duration   string   `docopt:"<duration>"`
+	Attendees  []string `docopt:"<attendee>"`
+
+	CalendarNames []string `docopt:"--calendar"`
 
 	// options
-	UseAppleMaps   bool `env:"APPLE_MAPS"`
-	EventCacheMins int  `env:"EVENT_CACHE_MINS"`
-	ScheduleDays   int  `env:"SCHEDULE_DAYS"`
-	Use12HourTime  bool `env:"TIME_12H"`
+	UseAppleMaps   bool   `env:"APPLE_MAPS"`
+	CalendarApp    string `env:"CALENDAR_APP"`
+	EventCacheMins int    `env:"EVENT_CACHE_MINS"`
+	MaxResults     int    `env:"MAX_RESULTS"`
+	Locale         string `env:"LOCALE"`
+	DisplayTZ      string `env:"DISPLAY_TZ"`
+	SecondaryTZ    string `env:"SECONDARY_TZ"`
+	ScheduleDays   int    `env:"SCHEDULE_DAYS"`
+	SearchDays     int    `env:"SEARCH_DAYS"`
+	Reminders      bool   `env:"REMINDERS"`
+	SyncDaemon     bool   `env:"SYNC_DAEMON"`
+	ReminderMins   int    `env:"REMINDER_MINS"`
+	Notifier       string `env:"NOTIFIER"`
+	WorkStart      string `env:"WORK_START"`
+	WorkEnd        string `env:"WORK_END"`
+	Use12HourTime  bool   `env:"TIME_12H"`
 	ScheduleMode   bool
 	StartTime      time.Time
 	EndTime        time.Time
@@ -139,6 +219,44 @@ func (opts *options) MaxAgeEvents() time.Duration {
 	return d
 }
 
+// MaxItems returns the maximum number of events or calendars to
+// retrieve from a single calendar or account.
+func (opts *options) MaxItems() int {
+	if opts.MaxResults <= 0 {
+		return 10000
+	}
+	return opts.MaxResults
+}
+
+// WorkHours returns the start and end of the working day.
+func (opts *options) WorkHours() (start, end clock) {
+	start, end = clock{9, 0}, clock{17, 0}
+	if c, ok := parseClock(strings.ToLower(opts.WorkStart)); ok {
+		start = c
+	}
+	if c, ok := parseClock(strings.ToLower(opts.WorkEnd)); ok {
+		end = c
+	}
+	return
+}
+
+// ReminderLead returns how long before events without their own
+// reminders to show a reminder.
+func (opts *options) ReminderLead() time.Duration {
+	if opts.ReminderMins <= 0 {
+		return 10 * time.Minute
+	}
+	return time.Duration(opts.ReminderMins) * time.Minute
+}
+
+// SearchRange returns how many days into the past and future to search.
+func (opts *options) SearchRange() int {
+	if opts.SearchDays <= 0 {
+		return 365
+	}
+	return opts.SearchDays
+}
+
 func (opts *options) ScheduleDuration() time.Duration {
 	return time.Duration(opts.ScheduleDays) * time.Hour * 24
 }
@@ -146,7 +264,13 @@ func (opts *options) ScheduleDuration() time.Duration {
 func init() {
 	opts = &options{}
 
-	wf = aw.New(update.GitHub(repo), aw.HelpURL(helpURL))
+	// wf can't show errors yet, as it doesn't exist
+	env, err := workflowEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gcal: %v\ngcal must be run by Alfred or from the workflow's folder (next to info.plist).\n", err)
+		os.Exit(1)
+	}
+	wf = aw.NewFromEnv(env, update.GitHub(repo), aw.HelpURL(helpURL))
 	wf.Configure(aw.AddMagic(&calendarMagic{}, &loginMagic{}))
 
 	cacheDirIcons = filepath.Join(wf.CacheDir(), "icons")
@@ -167,16 +291,38 @@ func parseFlags() error {
 		return errors.Wrap(err, "bind config")
 	}
 
+	switch opts.Format {
+	case "", formatAlfred:
+	case formatJSON, formatTSV, formatText:
+		wf.Configure(aw.TextErrors(true))
+	case "ics":
+		if !opts.Export {
+			return errors.New("format \"ics\" is only supported by export")
+		}
+	default:
+		wf.Configure(aw.TextErrors(true))
+		return errors.Errorf("unsupported format: %q", opts.Format)
+	}
+
+	if err := setTimeZones(opts.DisplayTZ, opts.SecondaryTZ); err != nil {
+		return err
+	}
+
 	// We don't need to be fussy about the default start and end times:
 	// The default startTime is only used in schedule mode, and it (and endTime)
 	// will be set to midnight if user specifies a date.
-	opts.StartTime = time.Now().Local()
+	opts.StartTime = time.Now().In(displayTZ)
 	opts.ScheduleMode = true
 
 	if opts.Date != "" {
-		opts.StartTime, err = time.ParseInLocation(timeFormat, opts.Date, time.Local)
+		opts.StartTime, err = time.ParseInLocation(timeFormat, opts.Date, displayTZ)
 		if err != nil {
-			return err
+			// also accept "tomorrow", "next month" etc.
+			t, ok := parseDate(opts.Date)
+			if !ok {
+				return err
+			}
+			opts.StartTime = t
 		}
 		opts.ScheduleMode = false
 	}
@@ -185,6 +331,8 @@ func parseFlags() error {
 		hourFormat = "3:04"
 	}
 
+	locale = lookupLocale(opts.Locale)
+
 	opts.EndTime = opts.StartTime.Add(time.Hour * 24)
 
 	log.Printf("[main] query=%q, startTime=%v, endTime=%v",
@@ -215,6 +363,19 @@ func run() {
 		}
 	}
 
+	if !opts.Daemon {
+		if err := startDaemon(); err != nil {
+			wf.FatalError(err)
+		}
+	}
+
+	// scripts can't wait for calendars to load
+	if opts.Scripting() {
+		if err := prepareScripting(); err != nil {
+			wf.FatalError(err)
+		}
+	}
+
 	switch {
 	// check for Update first as Calendars and Events are also
 	// set by the corresponding top-level commands.
@@ -226,19 +387,47 @@ func run() {
 			err = doUpdateEvents()
 		case opts.Workflow:
 			err = doUpdateWorkflow()
+		case opts.Search:
+			err = doUpdateSearch()
+		case opts.Meet:
+			err = doUpdateMeet()
 		}
+	case opts.Caldav:
+		err = doAddCalDAV()
+	case opts.Subscribe:
+		err = doSubscribe()
+	case opts.Unsub:
+		err = doUnsubscribe()
 	case opts.Calendars:
 		err = doListCalendars()
 	case opts.Clear:
 		err = doClear()
 	case opts.Config:
 		err = doConfig()
+	case opts.Daemon:
+		err = doDaemon()
 	case opts.Dates:
 		err = doDates()
 	case opts.Events:
 		err = doEvents()
+	case opts.Export:
+		err = doExport()
+	case opts.Import:
+		err = doImport()
 	case opts.Logout:
 		err = doLogout()
+	case opts.Next:
+		err = doNext()
+	case opts.Free:
+		err = doFree()
+	case opts.Meet:
+		err = doMeet()
+	case opts.Week:
+		err = doAgenda("w")
+	case opts.Month:
+		err = doAgenda("m")
+	case opts.Search:
+		err = doSearch()
 	case opts.Open:
 		err = doOpen()
 	case opts.Set:
@@ -253,12 +442,24 @@ func run() {
 		err = doReload()
 	case opts.Create:
 		err = quickAdd()
+	case opts.Rsvp:
+		err = doRSVP()
+	case opts.Edit:
+		err = doEdit()
+	case opts.Move:
+		err = doMove()
+	case opts.Patch:
+		err = doPatch()
+	case opts.Delete:
+		err = doDelete()
+	case opts.Undo:
+		err = doUndo()
 	case opts.Active:
 		err = doListWritableCalendars()
 	}
 
 	if err != nil {
-		if err == errNoActive {
+		if err == errNoActive && !opts.Scripting() {
 			wf.NewItem("No active calendars").
 				Subtitle("↩ or ⇥ to choose calendars").
 				Autocomplete("workflow:calendars").
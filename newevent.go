@@ -0,0 +1,498 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Default length of new events if no end time or duration is given.
+const defaultEventDuration = time.Hour
+
+var (
+	errNoTitle    = errors.New("no event title")
+	errNoDateTime = errors.New("no event date or time")
+
+	clockRegex    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	rangeRegex    = regexp.MustCompile(`^(\d{1,2}(?::\d{2})?(?:am|pm)?)-(\d{1,2}(?::\d{2})?(?:am|pm)?)$`)
+	durationRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)(m|mins?|minutes?|h|hrs?|hours?|d|days?)$`)
+	isoDateRegex  = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}|\d{8}|[+-]\d+[dw]?)$`)
+
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday, "sunday": time.Sunday,
+		"mon": time.Monday, "monday": time.Monday,
+		"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+		"wed": time.Wednesday, "wednesday": time.Wednesday,
+		"thu": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+		"fri": time.Friday, "friday": time.Friday,
+		"sat": time.Saturday, "saturday": time.Saturday,
+	}
+
+	// iCalendar day codes for RRULE BYDAY
+	rruleDays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+	// iCalendar frequencies for "every <unit>" and "<adverb>"
+	frequencies = map[string]string{
+		"day": "DAILY", "days": "DAILY", "daily": "DAILY",
+		"week": "WEEKLY", "weeks": "WEEKLY", "weekly": "WEEKLY",
+		"month": "MONTHLY", "months": "MONTHLY", "monthly": "MONTHLY",
+		"year": "YEARLY", "years": "YEARLY", "yearly": "YEARLY", "annually": "YEARLY",
+	}
+)
+
+// EventSpec is a new event parsed from user input.
+type EventSpec struct {
+	Title      string
+	Start      time.Time
+	End        time.Time
+	AllDay     bool
+	Location   string
+	Attendees  []string        // Email addresses of people to invite
+	Recurrence string          // iCalendar RRULE, e.g. "RRULE:FREQ=WEEKLY"
+	Reminders  []time.Duration // Popup reminders before event starts
+}
+
+// Summary returns a one-line description of the event's details.
+func (spec *EventSpec) Summary() string {
+	var parts []string
+
+	if spec.AllDay {
+		s := locale.Short(spec.Start)
+		if last := spec.End.AddDate(0, 0, -1); last.After(spec.Start) {
+			s += " – " + locale.Short(last)
+		}
+		parts = append(parts, s+", all day")
+	} else {
+		parts = append(parts, fmt.Sprintf("%s, %s – %s",
+			locale.Short(spec.Start),
+			spec.Start.Format(hourFormat), spec.End.Format(hourFormat)))
+	}
+
+	if spec.Location != "" {
+		parts = append(parts, "at "+spec.Location)
+	}
+	if len(spec.Attendees) > 0 {
+		parts = append(parts, "with "+strings.Join(spec.Attendees, ", "))
+	}
+	if spec.Recurrence != "" {
+		parts = append(parts, "repeats "+strings.ToLower(strings.TrimPrefix(spec.Recurrence, "RRULE:")))
+	}
+	for _, d := range spec.Reminders {
+		parts = append(parts, "reminder "+humanDuration(d)+" before")
+	}
+
+	return strings.Join(parts, " / ")
+}
+
+// clock is a time of day.
+type clock struct {
+	hour, min int
+}
+
+// on returns clock's time on the given day.
+func (c clock) on(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), c.hour, c.min, 0, 0, day.Location())
+}
+
+// parseEventSpec parses a new event from text like
+// "Lunch tomorrow 12:30 for 1h at Cafe Rouge with bob@example.com".
+//
+// Recognised terms are dates (today, tomorrow, weekday names, YYYY-MM-DD,
+// +N[d|w]), times (14:00, 2pm, 2-3pm, from ... to ...), durations
+// ("for 90m"), location ("at ..."), attendees ("with <email>"), repetition
+// ("every week", "repeat daily") and reminders ("remind 10m"). All other
+// words form the event's title. Adverbs like "weekly" are only repetition
+// after "repeat" or if no title or location words follow them, so
+// "Weekly sync 10am" is a one-off event called "Weekly sync".
+//
+// An error is returned if no title or neither a date nor a time is found.
+func parseEventSpec(s string, now time.Time) (*EventSpec, error) {
+	var (
+		spec       = &EventSpec{}
+		words      = strings.Fields(s)
+		title      []string
+		location   []string
+		date       time.Time
+		start, end *clock
+		dur        time.Duration
+		inLocation bool
+
+		// "daily" etc. may be repetition or part of the title
+		repeatWord = -1
+		repeatFreq string
+		lastText   = -1 // index of last title or location word
+		lastList   *[]string
+	)
+
+	// peek returns the lowercase word at index i or an empty string.
+	peek := func(i int) string {
+		if i < len(words) {
+			return strings.ToLower(words[i])
+		}
+		return ""
+	}
+
+	for i := 0; i < len(words); i++ {
+		var (
+			w   = words[i]
+			lw  = strings.ToLower(w)
+			nxt = peek(i + 1)
+		)
+
+		// time ranges, e.g. 14:00-15:30 or 2-3pm
+		if s, e, ok := parseClockRange(lw); ok {
+			start, end = &s, &e
+			inLocation = false
+			continue
+		}
+
+		if c, ok := parseClock(lw); ok {
+			start = &c
+			inLocation = false
+			continue
+		}
+
+		if t, ok := parseEventDate(lw, now); ok {
+			date = t
+			inLocation = false
+			continue
+		}
+
+		if freq, ok := frequencies[lw]; ok && strings.HasSuffix(lw, "ly") {
+			repeatWord, repeatFreq = i, freq
+		}
+
+		switch lw {
+		case "at", "@":
+			if c, ok := parseClock(nxt); ok {
+				start = &c
+				i++
+				continue
+			}
+			if nxt != "" {
+				inLocation = true
+				continue
+			}
+
+		case "on":
+			if _, ok := parseEventDate(nxt, now); ok {
+				continue
+			}
+
+		case "from":
+			if c, ok := parseClock(nxt); ok {
+				start = &c
+				inLocation = false
+				i++
+				continue
+			}
+
+		case "to", "until", "till", "-", "–":
+			if c, ok := parseClock(nxt); ok && start != nil {
+				end = &c
+				inLocation = false
+				i++
+				continue
+			}
+
+		case "for":
+			if d, n := parseDurationWords(words[i+1:]); n > 0 {
+				dur = d
+				inLocation = false
+				i += n
+				continue
+			}
+
+		case "with":
+			var emails []string
+			for j := i + 1; j < len(words); j++ {
+				addr := strings.Trim(words[j], ",;")
+				if peek(j) == "and" {
+					continue
+				}
+				if !strings.Contains(addr, "@") {
+					break
+				}
+				emails = append(emails, addr)
+				i = j
+			}
+			if len(emails) > 0 {
+				spec.Attendees = append(spec.Attendees, emails...)
+				inLocation = false
+				continue
+			}
+
+		case "every":
+			if rule, n := parseRepeat(words[i+1:]); n > 0 {
+				spec.Recurrence = rule
+				if wd, ok := weekdays[peek(i+n)]; ok && date.IsZero() {
+					date = nextWeekday(now, wd)
+				}
+				inLocation = false
+				i += n
+				continue
+			}
+
+		case "repeat", "repeats", "repeating":
+			if freq, ok := frequencies[nxt]; ok && strings.HasSuffix(nxt, "ly") {
+				spec.Recurrence = "RRULE:FREQ=" + freq
+				inLocation = false
+				i++
+				continue
+			}
+
+		case "remind", "reminder", "alert":
+			j := i + 1
+			if peek(j) == "me" {
+				j++
+			}
+			if d, n := parseDurationWords(words[j:]); n > 0 {
+				spec.Reminders = append(spec.Reminders, d)
+				i = j + n - 1
+				if peek(i+1) == "before" {
+					i++
+				}
+				inLocation = false
+				continue
+			}
+		}
+
+		lastList = &title
+		if inLocation {
+			lastList = &location
+		}
+		*lastList = append(*lastList, w)
+		lastText = i
+	}
+
+	// trailing "daily" etc., unless it's the whole title
+	if repeatWord >= 0 && repeatWord == lastText && spec.Recurrence == "" &&
+		(lastList == &location || len(title) > 1) {
+		*lastList = (*lastList)[:len(*lastList)-1]
+		spec.Recurrence = "RRULE:FREQ=" + repeatFreq
+	}
+
+	spec.Title = strings.Join(title, " ")
+	spec.Location = strings.Join(location, " ")
+
+	if spec.Title == "" {
+		return nil, errNoTitle
+	}
+
+	switch {
+	case start != nil:
+		if date.IsZero() {
+			date = midnight(now)
+		}
+		spec.Start = start.on(date)
+
+		switch {
+		case end != nil:
+			spec.End = end.on(date)
+			if !spec.End.After(spec.Start) {
+				spec.End = spec.End.AddDate(0, 0, 1)
+			}
+		case dur > 0:
+			spec.End = spec.Start.Add(dur)
+		default:
+			spec.End = spec.Start.Add(defaultEventDuration)
+		}
+
+	case !date.IsZero():
+		spec.AllDay = true
+		spec.Start = date
+		days := int(dur.Hours() / 24)
+		if days < 1 {
+			days = 1
+		}
+		spec.End = date.AddDate(0, 0, days)
+
+	default:
+		return nil, errNoDateTime
+	}
+
+	return spec, nil
+}
+
+// parseClock parses a time of day, e.g. "14:00", "2pm" or "9:30am".
+// Bare numbers are not accepted.
+func parseClock(s string) (clock, bool) {
+	m := clockRegex.FindStringSubmatch(s)
+	if m == nil || (m[2] == "" && m[3] == "") {
+		return clock{}, false
+	}
+
+	h, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+
+	if m[3] != "" {
+		if h < 1 || h > 12 {
+			return clock{}, false
+		}
+		h %= 12
+		if m[3] == "pm" {
+			h += 12
+		}
+	}
+
+	if h > 23 || min > 59 {
+		return clock{}, false
+	}
+
+	return clock{h, min}, true
+}
+
+// parseClockRange parses a time range like "14:00-15:30" or "2-3pm".
+// If only the end time has am/pm, it also applies to the start time.
+func parseClockRange(s string) (clock, clock, bool) {
+	m := rangeRegex.FindStringSubmatch(s)
+	if m == nil {
+		return clock{}, clock{}, false
+	}
+
+	end, ok := parseClock(m[2])
+	if !ok {
+		return clock{}, clock{}, false
+	}
+
+	start, ok := parseClock(m[1])
+	if !ok {
+		suffix := m[2][len(m[2])-2:]
+		if suffix != "am" && suffix != "pm" {
+			return clock{}, clock{}, false
+		}
+		if start, ok = parseClock(m[1] + suffix); !ok {
+			return clock{}, clock{}, false
+		}
+		// e.g. 11-1pm
+		if start.hour > end.hour && suffix == "pm" {
+			start.hour -= 12
+		}
+	}
+
+	return start, end, true
+}
+
+// parseEventDate parses a date word, e.g. "tomorrow", "fri" or "2019-12-24".
+func parseEventDate(s string, now time.Time) (time.Time, bool) {
+	switch s {
+	case "today":
+		return midnight(now), true
+	case "tomorrow":
+		return midnight(now).AddDate(0, 0, 1), true
+	}
+
+	if wd, ok := weekdays[s]; ok {
+		return nextWeekday(now, wd), true
+	}
+
+	if isoDateRegex.MatchString(s) {
+		return parseDate(s)
+	}
+
+	return time.Time{}, false
+}
+
+// nextWeekday returns the date of the next given weekday after now.
+func nextWeekday(now time.Time, wd time.Weekday) time.Time {
+	n := (int(wd) - int(now.Weekday()) + 7) % 7
+	if n == 0 {
+		n = 7
+	}
+	return midnight(now).AddDate(0, 0, n)
+}
+
+// parseDurationWords parses a duration from the start of words, e.g. "90m",
+// "1h30m" or "2 hours". It returns the duration and number of words used.
+func parseDurationWords(words []string) (time.Duration, int) {
+	if len(words) == 0 {
+		return 0, 0
+	}
+
+	if d, ok := parseDuration(words[0]); ok {
+		return d, 1
+	}
+
+	if len(words) > 1 {
+		if d, ok := parseDuration(words[0] + words[1]); ok {
+			return d, 2
+		}
+	}
+
+	return 0, 0
+}
+
+// parseDuration parses a duration like "30m", "2hrs", "1.5h", "3d" or "1h30m".
+func parseDuration(s string) (time.Duration, bool) {
+	s = strings.ToLower(s)
+
+	if m := durationRegex.FindStringSubmatch(s); m != nil {
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return 0, false
+		}
+
+		unit := time.Minute
+		switch m[2][0] {
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = oneDay
+		}
+
+		return time.Duration(n * float64(unit)), true
+	}
+
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, true
+	}
+
+	return 0, false
+}
+
+// parseRepeat parses the words following "every", e.g. "week", "2 weeks",
+// "weekday" or "monday". It returns an RRULE and the number of words used.
+func parseRepeat(words []string) (string, int) {
+	var (
+		interval = 1
+		n        int
+	)
+
+	if len(words) == 0 {
+		return "", 0
+	}
+
+	if i, err := strconv.Atoi(words[0]); err == nil && i > 0 && len(words) > 1 {
+		interval = i
+		words = words[1:]
+		n++
+	}
+
+	var (
+		w    = strings.ToLower(words[0])
+		rule string
+	)
+
+	if freq, ok := frequencies[w]; ok {
+		rule = "RRULE:FREQ=" + freq
+	} else if wd, ok := weekdays[w]; ok {
+		rule = "RRULE:FREQ=WEEKLY;BYDAY=" + rruleDays[wd]
+	} else if w == "weekday" {
+		rule = "RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"
+	} else {
+		return "", 0
+	}
+
+	if interval > 1 {
+		rule += ";INTERVAL=" + strconv.Itoa(interval)
+	}
+
+	return rule, n + 1
+}
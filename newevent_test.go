@@ -0,0 +1,73 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseEventSpec(t *testing.T) {
+	// Wednesday
+	now := time.Date(2019, 4, 3, 10, 0, 0, 0, time.Local)
+	at := func(day, h, m int) time.Time { return time.Date(2019, 4, day, h, m, 0, 0, time.Local) }
+
+	tests := []struct {
+		in string
+		x  EventSpec
+	}{
+		{"Standup 9:30", EventSpec{Title: "Standup", Start: at(3, 9, 30), End: at(3, 10, 30)}},
+		{"Lunch tomorrow 12:30 for 90m at Cafe Rouge",
+			EventSpec{Title: "Lunch", Start: at(4, 12, 30), End: at(4, 14, 0), Location: "Cafe Rouge"}},
+		{"Lunch at Cafe Rouge on fri at 1pm",
+			EventSpec{Title: "Lunch", Start: at(5, 13, 0), End: at(5, 14, 0), Location: "Cafe Rouge"}},
+		{"Review 2-3pm with a@example.com, b@example.com",
+			EventSpec{Title: "Review", Start: at(3, 14, 0), End: at(3, 15, 0),
+				Attendees: []string{"a@example.com", "b@example.com"}}},
+		{"Call with Ian from 16:00 to 16:45",
+			EventSpec{Title: "Call with Ian", Start: at(3, 16, 0), End: at(3, 16, 45)}},
+		{"Planning every monday 10am remind 10m",
+			EventSpec{Title: "Planning", Start: at(8, 10, 0), End: at(8, 11, 0),
+				Recurrence: "RRULE:FREQ=WEEKLY;BYDAY=MO", Reminders: []time.Duration{10 * time.Minute}}},
+		{"Gym daily 7am for 1 hour",
+			EventSpec{Title: "Gym", Start: at(3, 7, 0), End: at(3, 8, 0), Recurrence: "RRULE:FREQ=DAILY"}},
+		{"Retro every 2 weeks thu 11-1pm",
+			EventSpec{Title: "Retro", Start: at(4, 11, 0), End: at(4, 13, 0),
+				Recurrence: "RRULE:FREQ=WEEKLY;INTERVAL=2"}},
+		{"Conference 2019-04-10 for 3d",
+			EventSpec{Title: "Conference", Start: at(10, 0, 0), End: at(13, 0, 0), AllDay: true}},
+		{"Holiday tomorrow", EventSpec{Title: "Holiday", Start: at(4, 0, 0), End: at(5, 0, 0), AllDay: true}},
+		// repetition words are only repetition at the end or after "repeat"
+		{"Weekly sync 10am", EventSpec{Title: "Weekly sync", Start: at(3, 10, 0), End: at(3, 11, 0)}},
+		{"Sync 10am weekly",
+			EventSpec{Title: "Sync", Start: at(3, 10, 0), End: at(3, 11, 0), Recurrence: "RRULE:FREQ=WEEKLY"}},
+		{"Daily standup 9am repeat weekly",
+			EventSpec{Title: "Daily standup", Start: at(3, 9, 0), End: at(3, 10, 0), Recurrence: "RRULE:FREQ=WEEKLY"}},
+		{"Lunch at Cafe Rouge monthly 1pm",
+			EventSpec{Title: "Lunch", Start: at(3, 13, 0), End: at(3, 14, 0), Location: "Cafe Rouge",
+				Recurrence: "RRULE:FREQ=MONTHLY"}},
+		{"Daily 9am", EventSpec{Title: "Daily", Start: at(3, 9, 0), End: at(3, 10, 0)}},
+		// "3d" isn't a date
+		{"Print 3d model tomorrow", EventSpec{Title: "Print 3d model", Start: at(4, 0, 0), End: at(5, 0, 0), AllDay: true}},
+	}
+
+	for _, td := range tests {
+		spec, err := parseEventSpec(td.in, now)
+		if err != nil {
+			t.Errorf("parse %q: %v", td.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(*spec, td.x) {
+			t.Errorf("Bad spec for %q.\nExpected=%+v\n     Got=%+v", td.in, td.x, *spec)
+		}
+	}
+
+	// Unparseable events fall back to QuickAdd
+	for _, s := range []string{"", "Wash pants", "Drink beer every day 2000-2200", "10:00"} {
+		if _, err := parseEventSpec(s, now); err == nil {
+			t.Errorf("no error parsing %q", s)
+		}
+	}
+}
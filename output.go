@@ -0,0 +1,323 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/deanishe/awgo/fuzzy"
+	"github.com/pkg/errors"
+)
+
+// Output formats. See "Scripting" in README.md for a description of the
+// JSON and TSV formats. Don't change them in incompatible ways.
+const (
+	formatAlfred = "alfred" // Alfred Script Filter JSON
+	formatJSON   = "json"   // JSON array of objects
+	formatTSV    = "tsv"    // Tab-separated values with a header row
+	formatText   = "text"   // Human-readable agenda
+)
+
+// Scripting returns true if output is for scripts, not Alfred.
+func (opts *options) Scripting() bool {
+	return opts.Format != "" && opts.Format != formatAlfred
+}
+
+// prepareScripting makes sure there are calendars to show, as scripts
+// can't wait for Alfred to reload results.
+func prepareScripting() error {
+	if len(accounts) == 0 {
+		return errors.New("no accounts configured")
+	}
+
+	for _, acc := range accounts {
+		if len(acc.Calendars) > 0 {
+			return nil
+		}
+	}
+
+	return syncCalendars()
+}
+
+// fuzzyMatch returns true if s matches query like Alfred results do.
+func fuzzyMatch(s, query string) bool {
+	return query == "" || fuzzy.Match(s, query).Match
+}
+
+// eventJSON is the JSON representation of Event.
+type eventJSON struct {
+	ID            string         `json:"id"`
+	UID           string         `json:"uid"`
+	CalendarID    string         `json:"calendar_id"`
+	Calendar      string         `json:"calendar"`
+	Title         string         `json:"title"`
+	Description   string         `json:"description"`
+	Location      string         `json:"location"`
+	Start         string         `json:"start"`
+	End           string         `json:"end"`
+	AllDay        bool           `json:"all_day"`
+	TimeZone      string         `json:"time_zone"`
+	Free          bool           `json:"free"`
+	Response      string         `json:"response"`
+	URL           string         `json:"url"`
+	ConferenceURL string         `json:"conference_url"`
+	Organizer     *attendeeJSON  `json:"organizer"`
+	Attendees     []attendeeJSON `json:"attendees"`
+	Reminders     []int          `json:"reminders"`
+}
+
+// attendeeJSON is the JSON representation of Attendee.
+type attendeeJSON struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Response string `json:"response"`
+	Optional bool   `json:"optional"`
+	Self     bool   `json:"self"`
+}
+
+// calendarJSON is the JSON representation of Calendar.
+type calendarJSON struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Account     string `json:"account"`
+	Colour      string `json:"colour"`
+	TimeZone    string `json:"time_zone"`
+	Active      bool   `json:"active"`
+	Writable    bool   `json:"writable"`
+}
+
+// dateJSON is the JSON representation of a date.
+type dateJSON struct {
+	Date     string `json:"date"`
+	Name     string `json:"name"`
+	Relative string `json:"relative"`
+}
+
+// eventTime formats the start or end of an event. All-day events have
+// dates, and timed events RFC 3339 times in DISPLAY_TZ.
+func eventTime(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format(timeFormat)
+	}
+	return t.In(displayTZ).Format(time.RFC3339)
+}
+
+// newEventJSON converts Event to its JSON representation.
+func newEventJSON(e *Event) eventJSON {
+	v := eventJSON{
+		ID:            e.ID,
+		UID:           e.IcalUID,
+		CalendarID:    e.CalendarID,
+		Calendar:      e.CalendarTitle,
+		Title:         e.Title,
+		Description:   e.Description,
+		Location:      e.Location,
+		Start:         eventTime(e.Start, e.AllDay),
+		End:           eventTime(e.End, e.AllDay),
+		AllDay:        e.AllDay,
+		TimeZone:      e.TimeZone,
+		Free:          e.Free,
+		Response:      e.Response,
+		URL:           e.URL,
+		ConferenceURL: e.ConferenceURL,
+		Attendees:     []attendeeJSON{},
+	}
+
+	person := func(a *Attendee) attendeeJSON {
+		return attendeeJSON{Name: a.Name, Email: a.Email, Response: a.Response, Optional: a.Optional, Self: a.Self}
+	}
+	if e.Organizer != nil {
+		o := person(e.Organizer)
+		v.Organizer = &o
+	}
+	for _, a := range e.Attendees {
+		v.Attendees = append(v.Attendees, person(a))
+	}
+
+	// nil means the calendar's default reminders
+	if e.Reminders != nil {
+		v.Reminders = []int{}
+		for _, d := range e.Reminders {
+			v.Reminders = append(v.Reminders, int(d.Minutes()))
+		}
+	}
+
+	return v
+}
+
+// calendarWritable returns true if the user may add events to calendar.
+func calendarWritable(c *Calendar) bool {
+	acc, err := accountForCalendar(c.ID)
+	return err == nil && acc.ReadWrite
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeTSV writes a header and rows of tab-separated values. Tabs and
+// newlines in values are replaced with spaces.
+func writeTSV(w io.Writer, header []string, rows [][]string) error {
+	clean := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+	for _, row := range append([][]string{header}, rows...) {
+		for i, s := range row {
+			row[i] = clean.Replace(s)
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeEvents writes events in the given format.
+func writeEvents(w io.Writer, format string, events []*Event) error {
+	switch format {
+	case formatJSON:
+		out := []eventJSON{}
+		for _, e := range events {
+			out = append(out, newEventJSON(e))
+		}
+		return writeJSON(w, out)
+
+	case formatTSV:
+		var rows [][]string
+		for _, e := range events {
+			rows = append(rows, []string{
+				eventTime(e.Start, e.AllDay), eventTime(e.End, e.AllDay), fmt.Sprint(e.AllDay),
+				e.Title, e.CalendarTitle, e.Location, e.ID, e.CalendarID,
+			})
+		}
+		return writeTSV(w, []string{"start", "end", "all_day", "title", "calendar", "location", "id", "calendar_id"}, rows)
+
+	case formatText:
+		return writeAgenda(w, events)
+	}
+
+	return fmt.Errorf("unsupported format: %q", format)
+}
+
+// writeAgenda writes events grouped by day.
+func writeAgenda(w io.Writer, events []*Event) error {
+	if len(events) == 0 {
+		_, err := fmt.Fprintln(w, "No events")
+		return err
+	}
+
+	var start, end time.Time
+	for _, e := range events {
+		if start.IsZero() || e.Start.Before(start) {
+			start = e.Start
+		}
+		if e.End.After(end) {
+			end = e.End
+		}
+	}
+
+	var b strings.Builder
+	for i, d := range groupByDay(events, midnight(start), end) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(locale.Long(d.Date) + "\n")
+
+		for _, e := range d.Events {
+			when := "all day"
+			if !e.AllDay {
+				when = e.Start.In(displayTZ).Format(hourFormat) + " – " + e.End.In(displayTZ).Format(hourFormat)
+			}
+			line := fmt.Sprintf("  %-13s  %s (%s)", when, e.Title, e.CalendarTitle)
+			if e.Location != "" {
+				line += " / " + e.Location
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeCalendars writes calendars in the given format. active contains
+// the IDs of active calendars.
+func writeCalendars(w io.Writer, format string, cals []*Calendar, active map[string]bool) error {
+	switch format {
+	case formatJSON:
+		out := []calendarJSON{}
+		for _, c := range cals {
+			out = append(out, calendarJSON{
+				ID:          c.ID,
+				Title:       c.Title,
+				Description: c.Description,
+				Account:     c.AccountName,
+				Colour:      c.Colour,
+				TimeZone:    c.TimeZone,
+				Active:      active[c.ID],
+				Writable:    calendarWritable(c),
+			})
+		}
+		return writeJSON(w, out)
+
+	case formatTSV:
+		var rows [][]string
+		for _, c := range cals {
+			rows = append(rows, []string{
+				c.ID, c.Title, c.AccountName, c.Colour,
+				fmt.Sprint(active[c.ID]), fmt.Sprint(calendarWritable(c)),
+			})
+		}
+		return writeTSV(w, []string{"id", "title", "account", "colour", "active", "writable"}, rows)
+
+	case formatText:
+		var b strings.Builder
+		for _, c := range cals {
+			on := "[ ]"
+			if active[c.ID] {
+				on = "[x]"
+			}
+			fmt.Fprintf(&b, "%s %s (%s)\n", on, c.Title, c.AccountName)
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	return fmt.Errorf("unsupported format: %q", format)
+}
+
+// writeDates writes dates in the given format.
+func writeDates(w io.Writer, format string, dates []time.Time) error {
+	switch format {
+	case formatJSON:
+		out := []dateJSON{}
+		for _, t := range dates {
+			out = append(out, dateJSON{t.Format(timeFormat), locale.Long(t), relativeDays(t, false)})
+		}
+		return writeJSON(w, out)
+
+	case formatTSV:
+		var rows [][]string
+		for _, t := range dates {
+			rows = append(rows, []string{t.Format(timeFormat), locale.Long(t), relativeDays(t, false)})
+		}
+		return writeTSV(w, []string{"date", "name", "relative"}, rows)
+
+	case formatText:
+		var b strings.Builder
+		for _, t := range dates {
+			fmt.Fprintf(&b, "%s  %s (%s)\n", t.Format(timeFormat), locale.Long(t), relativeDays(t, false))
+		}
+		_, err := io.WriteString(w, b.String())
+		return err
+	}
+
+	return fmt.Errorf("unsupported format: %q", format)
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteEvents(t *testing.T) {
+	defer func(display, secondary *time.Location, d time.Time) {
+		displayTZ, secondaryTZ = display, secondary
+		today, tomorrow, yesterday = d, d.AddDate(0, 0, 1), d.AddDate(0, 0, -1)
+	}(displayTZ, secondaryTZ, today)
+
+	if err := setTimeZones("Europe/Berlin", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		start  = time.Date(2019, 4, 3, 8, 0, 0, 0, time.UTC)
+		events = []*Event{
+			{
+				ID:            "holiday",
+				Title:         "Holiday",
+				Start:         time.Date(2019, 4, 3, 0, 0, 0, 0, displayTZ),
+				End:           time.Date(2019, 4, 4, 0, 0, 0, 0, displayTZ),
+				AllDay:        true,
+				CalendarID:    "home",
+				CalendarTitle: "Home",
+			},
+			{
+				ID:            "abc",
+				IcalUID:       "abc@google.com",
+				Title:         "Planning",
+				Description:   "Agenda:\n1. Budget",
+				Location:      "Room\t1",
+				Start:         start,
+				End:           start.Add(time.Hour),
+				CalendarID:    "work",
+				CalendarTitle: "Work",
+				Reminders:     []time.Duration{15 * time.Minute},
+				Attendees:     []*Attendee{{Email: "bob@example.com", Response: "accepted"}},
+			},
+		}
+	)
+
+	var b strings.Builder
+	if err := writeEvents(&b, formatJSON, events); err != nil {
+		t.Fatal(err)
+	}
+
+	var out []map[string]interface{}
+	if err := json.Unmarshal([]byte(b.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(out))
+	}
+	for k, x := range map[string]interface{}{
+		"start": "2019-04-03", "end": "2019-04-04", "all_day": true, "calendar": "Home", "reminders": nil,
+	} {
+		if v := out[0][k]; v != x {
+			t.Errorf("Bad %s. Expected=%v, Got=%v", k, x, v)
+		}
+	}
+	for k, x := range map[string]interface{}{
+		"uid": "abc@google.com", "start": "2019-04-03T10:00:00+02:00", "end": "2019-04-03T11:00:00+02:00",
+		"calendar_id": "work", "description": "Agenda:\n1. Budget",
+	} {
+		if v := out[1][k]; v != x {
+			t.Errorf("Bad %s. Expected=%v, Got=%v", k, x, v)
+		}
+	}
+	if v, ok := out[1]["attendees"].([]interface{}); !ok || len(v) != 1 {
+		t.Errorf("Bad attendees: %v", out[1]["attendees"])
+	}
+	if v, ok := out[1]["reminders"].([]interface{}); !ok || len(v) != 1 || v[0] != 15.0 {
+		t.Errorf("Bad reminders: %v", out[1]["reminders"])
+	}
+
+	b.Reset()
+	if err := writeEvents(&b, formatTSV, events); err != nil {
+		t.Fatal(err)
+	}
+	x := "start\tend\tall_day\ttitle\tcalendar\tlocation\tid\tcalendar_id\n" +
+		"2019-04-03\t2019-04-04\ttrue\tHoliday\tHome\t\tholiday\thome\n" +
+		"2019-04-03T10:00:00+02:00\t2019-04-03T11:00:00+02:00\tfalse\tPlanning\tWork\tRoom 1\tabc\twork\n"
+	if v := b.String(); v != x {
+		t.Errorf("Bad TSV. Expected=%q, Got=%q", x, v)
+	}
+
+	b.Reset()
+	if err := writeEvents(&b, formatText, events); err != nil {
+		t.Fatal(err)
+	}
+	x = locale.Long(events[0].Start) + "\n" +
+		"  all day        Holiday (Home)\n" +
+		"  10:00 – 11:00  Planning (Work) / Room\t1\n"
+	if v := b.String(); v != x {
+		t.Errorf("Bad agenda. Expected=%q, Got=%q", x, v)
+	}
+
+	// empty output is still valid
+	b.Reset()
+	if err := writeEvents(&b, formatJSON, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v := strings.TrimSpace(b.String()); v != "[]" {
+		t.Errorf("Bad empty JSON: %q", v)
+	}
+
+	if err := writeEvents(&b, "xml", events); err == nil {
+		t.Error("Accepted bad format")
+	}
+}
+
+func TestWriteCalendars(t *testing.T) {
+	cals := []*Calendar{
+		{ID: "work", Title: "Work", AccountName: "alice@example.com", Colour: "#FF2968"},
+		{ID: "home", Title: "Home", AccountName: "alice@example.com"},
+	}
+	active := map[string]bool{"work": true}
+
+	var b strings.Builder
+	if err := writeCalendars(&b, formatJSON, cals, active); err != nil {
+		t.Fatal(err)
+	}
+
+	var out []calendarJSON
+	if err := json.Unmarshal([]byte(b.String()), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0].ID != "work" || !out[0].Active || out[1].Active || out[0].Colour != "#FF2968" {
+		t.Errorf("Bad calendars: %+v", out)
+	}
+
+	b.Reset()
+	if err := writeCalendars(&b, formatText, cals, active); err != nil {
+		t.Fatal(err)
+	}
+	x := "[x] Work (alice@example.com)\n[ ] Home (alice@example.com)\n"
+	if v := b.String(); v != x {
+		t.Errorf("Bad text. Expected=%q, Got=%q", x, v)
+	}
+}
+
+func TestWriteDates(t *testing.T) {
+	var b strings.Builder
+	if err := writeDates(&b, formatTSV, []time.Time{today}); err != nil {
+		t.Fatal(err)
+	}
+
+	x := "date\tname\trelative\n" + today.Format(timeFormat) + "\t" + locale.Long(today) + "\t" + locale.Today + "\n"
+	if v := b.String(); v != x {
+		t.Errorf("Bad TSV. Expected=%q, Got=%q", x, v)
+	}
+
+	if n := len(scriptDates("")); n != 7 {
+		t.Errorf("Expected 7 dates, got %d", n)
+	}
+	if d := scriptDates("tomorrow"); len(d) != 1 || !d[0].Equal(tomorrow) {
+		t.Errorf("Bad date: %v", d)
+	}
+	if d := scriptDates("not a date"); len(d) != 0 {
+		t.Errorf("Parsed invalid date: %v", d)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/api/calendar/v3"
+)
+
+// CalendarProvider is a calendar service, such as Google Calendar,
+// a CalDAV server or subscribed feeds. Each Account has one.
+type CalendarProvider interface {
+	// Calendars returns the user's calendars.
+	Calendars() ([]*Calendar, error)
+	// Events returns events in cal that overlap the period start to end.
+	// Recurring events are expanded into their occurrences.
+	Events(cal *Calendar, start, end time.Time) ([]*Event, error)
+	// CreateEvent adds a new event to cal.
+	CreateEvent(cal *Calendar, spec *EventSpec) error
+	// UpdateEvent saves one field of Event: "title", "location" or
+	// "start" (which also saves the end). Other fields are left as they
+	// are on the server, as Event may be out of date.
+	UpdateEvent(cal *Calendar, e *Event, field string) error
+	// DeleteEvent removes an event from cal.
+	DeleteEvent(cal *Calendar, eventID string) error
+	// ImportEvent adds the event in VCALENDAR vc (see splitEvents) to cal,
+	// or updates it if cal already has an event with the same UID.
+	ImportEvent(cal *Calendar, vc *icalComponent) error
+}
+
+// syncProvider is a CalendarProvider that can fetch only the events that
+// have changed since the last sync.
+type syncProvider interface {
+	CalendarProvider
+	// SyncEvents is like Events, but also returns a token for SyncChanges.
+	SyncEvents(cal *Calendar, start, end time.Time) ([]*Event, string, error)
+	// SyncChanges returns changed events, the IDs of deleted events and
+	// a new token. It returns errSyncTokenExpired if a full sync is needed.
+	SyncChanges(cal *Calendar, token string) ([]*Event, []string, string, error)
+}
+
+// Provider returns the service Account's calendars are stored in.
+func (a *Account) Provider() CalendarProvider {
+	if a.IsFeeds() {
+		return &feedProvider{a.Feeds}
+	}
+	if a.CalDAV != nil {
+		return newCalDAVProvider(a.CalDAV.URL, a.CalDAV.Username, a.caldavPassword(), a.Name, nil)
+	}
+	return &googleProvider{a}
+}
+
+// IsGoogle returns true if Account is a Google account.
+func (a *Account) IsGoogle() bool { return a.CalDAV == nil && !a.IsFeeds() }
+
+// calendarByID returns Account's calendar with the given ID.
+func (a *Account) calendarByID(calendarID string) (*Calendar, error) {
+	for _, c := range a.Calendars {
+		if c.ID == calendarID {
+			return c, nil
+		}
+	}
+	return nil, errors.Errorf("no calendar %q in account %q", calendarID, a.Name)
+}
+
+// googleProvider is the Google Calendar API.
+type googleProvider struct {
+	acc *Account
+}
+
+// Calendars implements CalendarProvider.
+func (p *googleProvider) Calendars() ([]*Calendar, error) { return p.acc.fetchGoogleCalendars() }
+
+// Events implements CalendarProvider.
+func (p *googleProvider) Events(cal *Calendar, start, end time.Time) ([]*Event, error) {
+	events, _, err := p.acc.FetchEvents(cal, start, end)
+	return events, err
+}
+
+// SyncEvents implements syncProvider.
+func (p *googleProvider) SyncEvents(cal *Calendar, start, end time.Time) ([]*Event, string, error) {
+	return p.acc.FetchEvents(cal, start, end)
+}
+
+// SyncChanges implements syncProvider.
+func (p *googleProvider) SyncChanges(cal *Calendar, token string) ([]*Event, []string, string, error) {
+	return p.acc.FetchChanges(cal, token)
+}
+
+// CreateEvent implements CalendarProvider.
+func (p *googleProvider) CreateEvent(cal *Calendar, spec *EventSpec) error {
+	return p.acc.CreateEvent(cal, spec)
+}
+
+// UpdateEvent implements CalendarProvider. Times are saved in the event's
+// own time zone.
+func (p *googleProvider) UpdateEvent(cal *Calendar, e *Event, field string) error {
+	patch := &calendar.Event{}
+
+	switch field {
+	case "title":
+		patch.Summary = e.Title
+	case "location":
+		patch.Location = e.Location
+		patch.ForceSendFields = []string{"Location"}
+	case "start":
+		patch.Start = &calendar.EventDateTime{TimeZone: e.TimeZone}
+		patch.End = &calendar.EventDateTime{TimeZone: e.TimeZone}
+		if e.AllDay {
+			patch.Start.Date = e.Start.Format(timeFormat)
+			patch.End.Date = e.End.Format(timeFormat)
+		} else {
+			patch.Start.DateTime = e.Start.Format(time.RFC3339)
+			patch.End.DateTime = e.End.Format(time.RFC3339)
+		}
+	default:
+		return errors.Errorf("unknown event field: %s", field)
+	}
+
+	return p.acc.PatchEvent(cal.ID, e.ID, patch)
+}
+
+// DeleteEvent implements CalendarProvider.
+func (p *googleProvider) DeleteEvent(cal *Calendar, eventID string) error {
+	_, err := p.acc.DeleteEvent(cal.ID, eventID, false)
+	return err
+}
+
+// ImportEvent implements CalendarProvider.
+func (p *googleProvider) ImportEvent(cal *Calendar, vc *icalComponent) error {
+	return p.acc.ImportEvent(cal, vc)
+}
@@ -0,0 +1,303 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	remindersFile   = "reminders.json" // reminders already shown
+	reminderCheck   = time.Minute      // how often to check for due reminders
+	maxReminderLead = 28 * 24 * time.Hour
+)
+
+// Reminder is a notification that an Event is about to start.
+type Reminder struct {
+	Event *Event
+	Lead  time.Duration // how long before the event the reminder is due
+}
+
+// Due returns the time the reminder should be shown.
+func (r *Reminder) Due() time.Time { return r.Event.Start.Add(-r.Lead) }
+
+// Key uniquely identifies a reminder. It includes the start time, so
+// the reminder fires again if the event is moved.
+func (r *Reminder) Key() string {
+	return fmt.Sprintf("%s|%s|%s|%d", r.Event.CalendarID, r.Event.ID,
+		r.Event.Start.UTC().Format(time.RFC3339), int(r.Lead.Minutes()))
+}
+
+// Message returns the reminder text, e.g. "Starts in 10 min at 14:00 · Room 1".
+func (r *Reminder) Message(now time.Time) string {
+	var (
+		e     = r.Event
+		parts []string
+	)
+
+	if d := e.Start.Sub(now).Round(time.Minute); d > 0 {
+		parts = append(parts, fmt.Sprintf("Starts in %s at %s", humanDuration(d), e.Start.In(displayTZ).Format(hourFormat)))
+	} else {
+		parts = append(parts, "Starting now")
+	}
+
+	if e.Location != "" {
+		parts = append(parts, e.Location)
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// Notifier shows reminders to the user.
+type Notifier interface {
+	Notify(r *Reminder) error
+}
+
+// newNotifier returns the Notifier specified by NOTIFIER. "stdout" writes
+// reminders to STDOUT, any other non-empty value is run as a shell command
+// and the default shows a dialog.
+func newNotifier(name string) Notifier {
+	switch name {
+	case "":
+		return &dialogNotifier{}
+	case "stdout":
+		return &writerNotifier{w: os.Stdout}
+	default:
+		return &commandNotifier{command: name}
+	}
+}
+
+// writerNotifier writes reminders to an io.Writer. Useful for testing.
+type writerNotifier struct {
+	w   io.Writer
+	now func() time.Time
+}
+
+// Notify implements Notifier.
+func (n *writerNotifier) Notify(r *Reminder) error {
+	now := time.Now()
+	if n.now != nil {
+		now = n.now()
+	}
+
+	e := r.Event
+	_, err := fmt.Fprintf(n.w, "%s\t%s\t%s\t%s\n", e.Title, r.Message(now), e.ConferenceURL, e.URL)
+	return err
+}
+
+// commandNotifier runs a shell command for each reminder. Event details
+// are passed in the environment variables REMINDER_TITLE, REMINDER_MESSAGE,
+// REMINDER_START, REMINDER_LOCATION, REMINDER_JOIN_URL and REMINDER_URL.
+type commandNotifier struct {
+	command string
+}
+
+// Notify implements Notifier.
+func (n *commandNotifier) Notify(r *Reminder) error {
+	e := r.Event
+	cmd := exec.Command("/bin/sh", "-c", n.command)
+	cmd.Env = append(os.Environ(),
+		"REMINDER_TITLE="+e.Title,
+		"REMINDER_MESSAGE="+r.Message(time.Now()),
+		"REMINDER_START="+e.Start.Format(time.RFC3339),
+		"REMINDER_LOCATION="+e.Location,
+		"REMINDER_JOIN_URL="+e.ConferenceURL,
+		"REMINDER_URL="+e.URL,
+	)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return errors.Wrap(cmd.Run(), "run notifier command")
+}
+
+// dialogNotifier shows reminders in an AppleScript alert with buttons to
+// join the event's video call or open it in Google Calendar.
+type dialogNotifier struct{}
+
+// Notify implements Notifier. The alert is shown in the background, so
+// reminders for simultaneous events don't wait for each other.
+func (n *dialogNotifier) Notify(r *Reminder) error {
+	var (
+		e       = r.Event
+		buttons = []string{"Dismiss"}
+		urls    = map[string]string{}
+	)
+
+	if e.URL != "" {
+		buttons = append(buttons, "Open")
+		urls["Open"] = e.URL
+	}
+	if e.ConferenceURL != "" {
+		buttons = append(buttons, "Join")
+		urls["Join"] = e.ConferenceURL
+	}
+
+	quoted := make([]string, len(buttons))
+	for i, s := range buttons {
+		quoted[i] = asQuote(s)
+	}
+
+	script := fmt.Sprintf(`tell application "System Events"
+	activate
+	set res to display alert %s message %s buttons {%s} default button %s giving up after 600
+	return button returned of res
+end tell`, asQuote(e.Title), asQuote(r.Message(time.Now())),
+		strings.Join(quoted, ", "), asQuote(buttons[len(buttons)-1]))
+
+	cmd := exec.Command("/usr/bin/osascript", "-e", script)
+	go func() {
+		out, err := cmd.Output()
+		if err != nil {
+			log.Printf("[reminders] ERR: show alert: %v", err)
+			return
+		}
+
+		button := strings.TrimSpace(string(out))
+		if URL, ok := urls[button]; ok {
+			var args []string
+			// only calendar links are opened in CALENDAR_APP
+			if button == "Open" && opts.CalendarApp != "" {
+				args = append(args, "-a", opts.CalendarApp)
+			}
+			log.Printf("[reminders] opening %q ...", URL)
+			if err := exec.Command("/usr/bin/open", append(args, URL)...).Run(); err != nil {
+				log.Printf("[reminders] ERR: open %q: %v", URL, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// asQuote returns s as an AppleScript string literal.
+func asQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
+
+// eventReminders returns Event's reminders. Events with their own reminders
+// use those, other timed events get one reminder defaultLead before they
+// start. Declined events have no reminders.
+func eventReminders(e *Event, defaultLead time.Duration) []*Reminder {
+	if e.Response == "declined" {
+		return nil
+	}
+
+	leads := e.Reminders
+	if leads == nil {
+		if e.AllDay || defaultLead <= 0 {
+			return nil
+		}
+		leads = []time.Duration{defaultLead}
+	}
+
+	var reminders []*Reminder
+	for _, d := range leads {
+		reminders = append(reminders, &Reminder{Event: e, Lead: d})
+	}
+
+	return reminders
+}
+
+// dueReminders returns reminders for events that are due at now and haven't
+// been shown yet, i.e. aren't in fired. Reminders are not shown once an
+// event has started.
+func dueReminders(events []*Event, now time.Time, defaultLead time.Duration, fired map[string]time.Time) []*Reminder {
+	var due []*Reminder
+	for _, e := range events {
+		if !now.Before(e.Start) {
+			continue
+		}
+
+		for _, r := range eventReminders(e, defaultLead) {
+			if _, ok := fired[r.Key()]; ok || r.Due().After(now) {
+				continue
+			}
+			due = append(due, r)
+		}
+	}
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].Due().Before(due[j].Due()) })
+
+	return due
+}
+
+// runReminders checks for due reminders every minute and passes them
+// to Notifier until stop is closed.
+func runReminders(n Notifier, stop <-chan struct{}) {
+	log.Printf("[reminders] started (default=%v)", opts.ReminderLead())
+
+	ticker := time.NewTicker(reminderCheck)
+	defer ticker.Stop()
+
+	for {
+		if err := checkReminders(n, time.Now()); err != nil {
+			log.Printf("[reminders] ERR: %v", err)
+		}
+
+		select {
+		case <-stop:
+			log.Print("[reminders] stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkReminders shows reminders due at now. Shown reminders are saved to
+// the cache, so they aren't repeated if the process restarts.
+func checkReminders(n Notifier, now time.Time) error {
+	cals, err := activeCalendars()
+	if err != nil {
+		if err == errNoActive || err == errNoCalendars {
+			return nil
+		}
+		return errors.Wrap(err, "load calendars")
+	}
+
+	events, err := loadEvents(now, now.Add(maxReminderLead), cals...)
+	if err != nil {
+		return errors.Wrap(err, "load events")
+	}
+
+	fired := map[string]time.Time{}
+	if wf.Cache.Exists(remindersFile) {
+		if err := wf.Cache.LoadJSON(remindersFile, &fired); err != nil {
+			log.Printf("[reminders] ERR: load shown reminders: %v", err)
+		}
+	}
+
+	due := dueReminders(events, now, opts.ReminderLead(), fired)
+	if len(due) == 0 {
+		return nil
+	}
+
+	for _, r := range due {
+		log.Printf("[reminders] %q (%v before)", r.Event.Title, r.Lead)
+		if err := n.Notify(r); err != nil {
+			log.Printf("[reminders] ERR: notify %q: %v", r.Event.Title, err)
+			continue
+		}
+		fired[r.Key()] = r.Event.Start
+	}
+
+	// forget reminders for events that have already started
+	for k, t := range fired {
+		if t.Before(now) {
+			delete(fired, k)
+		}
+	}
+
+	return errors.Wrap(wf.Cache.StoreJSON(remindersFile, fired), "save shown reminders")
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDueReminders(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2019, 4, 3, h, m, 0, 0, displayTZ) }
+	var (
+		now     = at(9, 55)
+		lead    = 10 * time.Minute
+		standup = &Event{ID: "standup", Title: "Standup", Start: at(10, 0), End: at(10, 15)}
+		lunch   = &Event{ID: "lunch", Title: "Lunch", Start: at(12, 0), End: at(13, 0),
+			Reminders: []time.Duration{3 * time.Hour, time.Hour}}
+		review = &Event{ID: "review", Title: "Review", Start: at(10, 0), End: at(11, 0),
+			Reminders: []time.Duration{}}
+		declined = &Event{ID: "declined", Title: "Declined", Start: at(10, 0), End: at(11, 0),
+			Response: "declined"}
+		holiday = &Event{ID: "holiday", Title: "Holiday", Start: at(0, 0), End: at(24, 0), AllDay: true}
+		started = &Event{ID: "started", Title: "Started", Start: at(9, 30), End: at(10, 30)}
+		events  = []*Event{standup, lunch, review, declined, holiday, started}
+	)
+
+	due := dueReminders(events, now, lead, map[string]time.Time{})
+	if len(due) != 2 {
+		t.Fatalf("Expected 2 reminders, got %d", len(due))
+	}
+
+	// sorted by due time
+	if due[0].Event != lunch || due[0].Lead != 3*time.Hour {
+		t.Errorf("Expected lunch reminder (3h), got %q (%v)", due[0].Event.Title, due[0].Lead)
+	}
+	if due[1].Event != standup || due[1].Lead != lead {
+		t.Errorf("Expected standup reminder (%v), got %q (%v)", lead, due[1].Event.Title, due[1].Lead)
+	}
+
+	// reminders already shown aren't repeated
+	fired := map[string]time.Time{}
+	for _, r := range due {
+		fired[r.Key()] = r.Event.Start
+	}
+	if due := dueReminders(events, now, lead, fired); len(due) != 0 {
+		t.Errorf("Expected no reminders, got %d", len(due))
+	}
+
+	// moved event is reminded again
+	moved := *standup
+	moved.Start = at(10, 5)
+	if due := dueReminders([]*Event{&moved}, now, lead, fired); len(due) != 1 {
+		t.Errorf("Expected 1 reminder for moved event, got %d", len(due))
+	}
+}
+
+func TestWriterNotifier(t *testing.T) {
+	var (
+		buf   bytes.Buffer
+		start = time.Date(2019, 4, 3, 14, 0, 0, 0, displayTZ)
+		n     = &writerNotifier{w: &buf, now: func() time.Time { return start.Add(-10 * time.Minute) }}
+		e     = &Event{Title: "Standup", Start: start, Location: "Room 1",
+			ConferenceURL: "https://meet.google.com/abc", URL: "https://calendar.google.com/event"}
+	)
+
+	if err := n.Notify(&Reminder{Event: e, Lead: 10 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+
+	x := "Standup\tStarts in 10 min at 14:00 · Room 1\thttps://meet.google.com/abc\thttps://calendar.google.com/event\n"
+	if v := buf.String(); v != x {
+		t.Errorf("Expected=%q, Got=%q", x, v)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// iCalendar weekday abbreviations.
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// rruleDay is a BYDAY value, e.g. "MO" (every Monday) or "-1FR" (the last
+// Friday of the month or year).
+type rruleDay struct {
+	N   int // 0 means every such weekday
+	Day time.Weekday
+}
+
+// rrule is an iCalendar recurrence rule. Rules with a frequency of less
+// than a day and BYHOUR etc. aren't supported.
+type rrule struct {
+	Freq       string // DAILY, WEEKLY, MONTHLY or YEARLY
+	Interval   int
+	Count      int       // 0 means no limit
+	Until      time.Time // zero means no limit
+	ByDay      []rruleDay
+	ByMonthDay []int
+	ByMonth    []time.Month
+	BySetPos   []int
+	WeekStart  time.Weekday
+}
+
+// parseRRule parses the value of an RRULE property. Floating and date
+// UNTIL values are in loc.
+func parseRRule(s string, loc *time.Location) (*rrule, error) {
+	r := &rrule{Interval: 1, WeekStart: time.Monday}
+
+	for _, part := range strings.Split(strings.TrimPrefix(s, "RRULE:"), ";") {
+		i := strings.Index(part, "=")
+		if i < 0 {
+			continue
+		}
+
+		var (
+			key   = strings.ToUpper(part[:i])
+			value = strings.ToUpper(part[i+1:])
+			err   error
+		)
+
+		switch key {
+		case "FREQ":
+			r.Freq = value
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(value); err == nil && r.Interval < 1 {
+				err = errors.New("must be positive")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+		case "UNTIL":
+			r.Until, err = parseRRuleUntil(value, loc)
+		case "WKST":
+			d, ok := rruleWeekdays[value]
+			if !ok {
+				err = errors.New("unknown weekday")
+			}
+			r.WeekStart = d
+		case "BYDAY":
+			for _, v := range strings.Split(value, ",") {
+				var d rruleDay
+				if d, err = parseRRuleDay(v); err != nil {
+					break
+				}
+				r.ByDay = append(r.ByDay, d)
+			}
+		case "BYMONTHDAY":
+			r.ByMonthDay, err = parseInts(value)
+		case "BYMONTH":
+			var months []int
+			months, err = parseInts(value)
+			for _, n := range months {
+				r.ByMonth = append(r.ByMonth, time.Month(n))
+			}
+		case "BYSETPOS":
+			r.BySetPos, err = parseInts(value)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", key, value, err)
+		}
+	}
+
+	switch r.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	case "":
+		return nil, errors.New("rule has no FREQ")
+	default:
+		return nil, fmt.Errorf("unsupported frequency %q", r.Freq)
+	}
+
+	return r, nil
+}
+
+// parseRRuleUntil parses an UNTIL value. A date means the end of that day.
+func parseRRuleUntil(s string, loc *time.Location) (time.Time, error) {
+	switch {
+	case len(s) == len(icalDate):
+		t, err := time.ParseInLocation(icalDate, s, loc)
+		return t.AddDate(0, 0, 1).Add(-time.Second), err
+	case strings.HasSuffix(s, "Z"):
+		return time.Parse(icalUTC, s)
+	default:
+		return time.ParseInLocation(icalDateTime, s, loc)
+	}
+}
+
+// parseRRuleDay parses a BYDAY value like "TU" or "-1SU".
+func parseRRuleDay(s string) (rruleDay, error) {
+	if len(s) < 2 {
+		return rruleDay{}, errors.New("invalid weekday")
+	}
+
+	var (
+		d  rruleDay
+		ok bool
+		n  = s[:len(s)-2]
+	)
+
+	if d.Day, ok = rruleWeekdays[s[len(s)-2:]]; !ok {
+		return d, errors.New("unknown weekday")
+	}
+
+	if n != "" {
+		var err error
+		if d.N, err = strconv.Atoi(n); err != nil {
+			return d, err
+		}
+	}
+
+	return d, nil
+}
+
+// parseInts parses a comma-separated list of integers.
+func parseInts(s string) ([]int, error) {
+	var ints []int
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, n)
+	}
+	return ints, nil
+}
+
+// Between returns the start times of the occurrences of a series that
+// starts at dtstart and that start before end. dtstart is always the
+// first occurrence.
+func (r *rrule) Between(dtstart, end time.Time) []time.Time {
+	var (
+		times = []time.Time{dtstart}
+		rule  = r.withDefaults(dtstart)
+		day   = time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day(), 0, 0, 0, 0, dtstart.Location())
+		first time.Time // start of first period
+	)
+
+	switch r.Freq {
+	case "DAILY":
+		first = day
+	case "WEEKLY":
+		first = day.AddDate(0, 0, -((7 + int(day.Weekday()-r.WeekStart)) % 7))
+	case "MONTHLY":
+		first = day.AddDate(0, 0, 1-day.Day())
+	case "YEARLY":
+		first = day.AddDate(0, 0, 1-day.YearDay())
+	}
+
+	for i := 0; ; i++ {
+		var from, to time.Time // days of period
+
+		switch r.Freq {
+		case "DAILY":
+			from = first.AddDate(0, 0, i*r.Interval)
+			to = from.AddDate(0, 0, 1)
+		case "WEEKLY":
+			from = first.AddDate(0, 0, 7*i*r.Interval)
+			to = from.AddDate(0, 0, 7)
+		case "MONTHLY":
+			from = first.AddDate(0, i*r.Interval, 0)
+			to = from.AddDate(0, 1, 0)
+		case "YEARLY":
+			from = first.AddDate(i*r.Interval, 0, 0)
+			to = from.AddDate(1, 0, 0)
+		}
+
+		if !from.Before(end) || (!r.Until.IsZero() && from.After(r.Until)) {
+			break
+		}
+
+		for _, d := range rule.days(from, to) {
+			t := time.Date(d.Year(), d.Month(), d.Day(),
+				dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, dtstart.Location())
+
+			if !t.After(dtstart) {
+				continue
+			}
+			if !t.Before(end) || (!r.Until.IsZero() && t.After(r.Until)) {
+				return times
+			}
+			if r.Count > 0 && len(times) == r.Count {
+				return times
+			}
+			times = append(times, t)
+		}
+	}
+
+	return times
+}
+
+// withDefaults returns a copy of rrule with the day or month of dtstart
+// added where the rule doesn't specify one.
+func (r *rrule) withDefaults(dtstart time.Time) *rrule {
+	rule := *r
+
+	switch r.Freq {
+	case "WEEKLY":
+		if len(r.ByDay) == 0 {
+			rule.ByDay = []rruleDay{{Day: dtstart.Weekday()}}
+		}
+	case "MONTHLY":
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			rule.ByMonthDay = []int{dtstart.Day()}
+		}
+	case "YEARLY":
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			rule.ByMonthDay = []int{dtstart.Day()}
+			if len(r.ByMonth) == 0 {
+				rule.ByMonth = []time.Month{dtstart.Month()}
+			}
+		}
+	}
+
+	return &rule
+}
+
+// days returns the days in the period from to to (exclusive) that match
+// the rule.
+func (r *rrule) days(from, to time.Time) []time.Time {
+	var days []time.Time
+
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		if r.matchMonth(d) && r.matchMonthDay(d) && r.matchDay(d) {
+			days = append(days, d)
+		}
+	}
+
+	if len(r.BySetPos) == 0 {
+		return days
+	}
+
+	var set []time.Time
+	for _, n := range r.BySetPos {
+		i := n - 1
+		if n < 0 {
+			i = len(days) + n
+		}
+		if i >= 0 && i < len(days) {
+			set = append(set, days[i])
+		}
+	}
+
+	sort.Slice(set, func(i, j int) bool { return set[i].Before(set[j]) })
+	return set
+}
+
+func (r *rrule) matchMonth(d time.Time) bool {
+	if len(r.ByMonth) == 0 {
+		return true
+	}
+	for _, m := range r.ByMonth {
+		if d.Month() == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *rrule) matchMonthDay(d time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+
+	last := d.AddDate(0, 1, -d.Day()).Day() // days in month
+	for _, n := range r.ByMonthDay {
+		if n == d.Day() || (n < 0 && last+n+1 == d.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDay reports whether d matches BYDAY. Numbered weekdays count from
+// the start (or end) of the month, or of the year in yearly rules without
+// BYMONTH.
+func (r *rrule) matchDay(d time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+
+	var (
+		index, fromEnd int // e.g. 2nd and 3rd-to-last Monday
+		inYear         = r.Freq == "YEARLY" && len(r.ByMonth) == 0
+	)
+
+	if inYear {
+		days := time.Date(d.Year(), 12, 31, 0, 0, 0, 0, d.Location()).YearDay()
+		index = (d.YearDay()-1)/7 + 1
+		fromEnd = (days-d.YearDay())/7 + 1
+	} else {
+		days := d.AddDate(0, 1, -d.Day()).Day()
+		index = (d.Day()-1)/7 + 1
+		fromEnd = (days-d.Day())/7 + 1
+	}
+
+	for _, bd := range r.ByDay {
+		if bd.Day != d.Weekday() {
+			continue
+		}
+		if bd.N == 0 || bd.N == index || -bd.N == fromEnd {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		in string
+		ok bool
+	}{
+		{"FREQ=WEEKLY", true},
+		{"RRULE:FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", true},
+		{"FREQ=YEARLY;BYMONTH=11;BYDAY=4TH;UNTIL=20301231", true},
+		{"FREQ=DAILY;INTERVAL=2;UNTIL=20190410T000000Z;WKST=SU", true},
+		{"FREQ=HOURLY", false},
+		{"INTERVAL=2", false},
+		{"FREQ=DAILY;INTERVAL=0", false},
+		{"FREQ=WEEKLY;BYDAY=XX", false},
+		{"FREQ=MONTHLY;BYMONTHDAY=one", false},
+	}
+
+	for _, td := range tests {
+		_, err := parseRRule(td.in, time.UTC)
+		if td.ok && err != nil {
+			t.Errorf("parseRRule(%q): %v", td.in, err)
+		}
+		if !td.ok && err == nil {
+			t.Errorf("parseRRule(%q): accepted invalid rule", td.in)
+		}
+	}
+}
+
+func TestRRuleBetween(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, berlin) }
+
+	tests := []struct {
+		rule    string
+		dtstart time.Time
+		end     time.Time
+		x       []time.Time
+	}{
+		// daily across a DST change keeps the local time
+		{"FREQ=DAILY", date(2019, 3, 30, 9), date(2019, 4, 1, 0),
+			[]time.Time{date(2019, 3, 30, 9), date(2019, 3, 31, 9)}},
+		{"FREQ=DAILY;INTERVAL=2;COUNT=3", date(2019, 4, 1, 9), date(2020, 1, 1, 0),
+			[]time.Time{date(2019, 4, 1, 9), date(2019, 4, 3, 9), date(2019, 4, 5, 9)}},
+		// Mon, Wed & Fri fortnightly
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE,FR;UNTIL=20190417T235959Z", date(2019, 4, 3, 10), date(2020, 1, 1, 0),
+			[]time.Time{date(2019, 4, 3, 10), date(2019, 4, 5, 10), date(2019, 4, 15, 10), date(2019, 4, 17, 10)}},
+		// weekly on the weekday of dtstart
+		{"FREQ=WEEKLY;COUNT=2", date(2019, 4, 3, 10), date(2020, 1, 1, 0),
+			[]time.Time{date(2019, 4, 3, 10), date(2019, 4, 10, 10)}},
+		// last Friday of the month
+		{"FREQ=MONTHLY;BYDAY=-1FR;COUNT=3", date(2019, 4, 26, 16), date(2020, 1, 1, 0),
+			[]time.Time{date(2019, 4, 26, 16), date(2019, 5, 31, 16), date(2019, 6, 28, 16)}},
+		// months without a 31st are skipped
+		{"FREQ=MONTHLY;COUNT=3", date(2019, 1, 31, 12), date(2020, 1, 1, 0),
+			[]time.Time{date(2019, 1, 31, 12), date(2019, 3, 31, 12), date(2019, 5, 31, 12)}},
+		// last working day of the month
+		{"FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=2", date(2019, 5, 31, 9), date(2020, 1, 1, 0),
+			[]time.Time{date(2019, 5, 31, 9), date(2019, 6, 28, 9)}},
+		// Thanksgiving
+		{"FREQ=YEARLY;BYMONTH=11;BYDAY=4TH", date(2019, 11, 28, 0), date(2021, 12, 1, 0),
+			[]time.Time{date(2019, 11, 28, 0), date(2020, 11, 26, 0), date(2021, 11, 25, 0)}},
+		// birthdays
+		{"FREQ=YEARLY", date(2018, 6, 2, 0), date(2020, 6, 2, 0),
+			[]time.Time{date(2018, 6, 2, 0), date(2019, 6, 2, 0)}},
+	}
+
+	for _, td := range tests {
+		r, err := parseRRule(td.rule, berlin)
+		if err != nil {
+			t.Errorf("parseRRule(%q): %v", td.rule, err)
+			continue
+		}
+
+		v := r.Between(td.dtstart, td.end)
+		if len(v) != len(td.x) {
+			t.Errorf("%q: Expected=%v, Got=%v", td.rule, td.x, v)
+			continue
+		}
+		for i := range v {
+			if !v[i].Equal(td.x[i]) {
+				t.Errorf("%q: Expected=%v, Got=%v", td.rule, td.x, v)
+				break
+			}
+		}
+	}
+}
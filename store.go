@@ -0,0 +1,307 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Days before and after today that are fully synced.
+	storePastDays   = 60
+	storeFutureDays = 365
+
+	// How often to do a full sync to move the synced window forward.
+	fullSyncInterval = 7 * 24 * time.Hour
+)
+
+var errSyncTokenExpired = errors.New("sync token expired")
+
+// Store is a local copy of a calendar's events. It is kept up to date
+// using the Calendar API's incremental sync.
+type Store struct {
+	CalendarID string
+	SyncToken  string            // Token to retrieve changes since last sync
+	Start      time.Time         // Start of fully-synced window
+	End        time.Time         // End of fully-synced window
+	FullSync   time.Time         // When store was last fully synced
+	Truncated  bool              // Whether full sync stopped at MAX_RESULTS events
+	Events     map[string]*Event // Events keyed by ID
+}
+
+// storeName returns the cache filename of a calendar's Store.
+func storeName(calendarID string) string {
+	return fmt.Sprintf("store-%x.json", sha1.Sum([]byte(calendarID)))
+}
+
+// LoadStore loads a calendar's Store from the cache. If there is no cached
+// Store, an empty one is returned.
+func LoadStore(calendarID string) (*Store, error) {
+	var (
+		s    = &Store{CalendarID: calendarID, Events: map[string]*Event{}}
+		name = storeName(calendarID)
+	)
+
+	if !wf.Cache.Exists(name) {
+		return s, nil
+	}
+
+	if err := wf.Cache.LoadJSON(name, s); err != nil {
+		return nil, errors.Wrap(err, "load event store")
+	}
+
+	if s.Events == nil {
+		s.Events = map[string]*Event{}
+	}
+
+	for _, e := range s.Events {
+		if e.AllDay {
+			e.Start, e.End = inDisplayTZ(e.Start), inDisplayTZ(e.End)
+		}
+	}
+
+	return s, nil
+}
+
+// Save writes Store to the cache.
+func (s *Store) Save() error {
+	if err := wf.Cache.StoreJSON(storeName(s.CalendarID), s); err != nil {
+		return errors.Wrap(err, "save event store")
+	}
+	return nil
+}
+
+// Sync updates Store from the server. Only changes since the last sync are
+// retrieved, unless Store has never been synced, its sync token has expired
+// or its window needs moving.
+func (s *Store) Sync(acc *Account, cal *Calendar) error {
+	return s.sync(acc.Provider(), cal)
+}
+
+// sync updates Store from provider p.
+func (s *Store) sync(p CalendarProvider, cal *Calendar) error {
+	sp, ok := p.(syncProvider)
+
+	if ok && s.SyncToken != "" && time.Since(s.FullSync) < fullSyncInterval {
+		changed, deleted, token, err := sp.SyncChanges(cal, s.SyncToken)
+		if err == nil {
+			for _, id := range deleted {
+				delete(s.Events, id)
+			}
+			for _, e := range changed {
+				s.Events[e.ID] = e
+			}
+			s.SyncToken = token
+
+			log.Printf("[store] %d changed, %d deleted event(s) in %q", len(changed), len(deleted), cal.Title)
+			return nil
+		}
+
+		if err != errSyncTokenExpired {
+			return err
+		}
+
+		log.Printf("[store] sync token for %q expired", cal.Title)
+	}
+
+	var (
+		today = midnight(time.Now())
+		start = today.AddDate(0, 0, -storePastDays)
+		end   = today.AddDate(0, 0, storeFutureDays)
+	)
+
+	var (
+		events []*Event
+		token  string
+		err    error
+	)
+
+	if ok {
+		events, token, err = sp.SyncEvents(cal, start, end)
+	} else {
+		events, err = p.Events(cal, start, end)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.Events = make(map[string]*Event, len(events))
+	for _, e := range events {
+		s.Events[e.ID] = e
+	}
+	s.SyncToken = token
+	s.Start, s.End = start, end
+	s.FullSync = time.Now()
+	s.Truncated = len(events) >= opts.MaxItems()
+
+	log.Printf("[store] %d event(s) in %q", len(events), cal.Title)
+	return nil
+}
+
+// Between returns Store's events that overlap the period start to end.
+func (s *Store) Between(start, end time.Time) []*Event {
+	var events []*Event
+	for _, e := range s.Events {
+		if e.End.After(start) && e.Start.Before(end) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// syncCalendar immediately updates the store of the specified calendar.
+func syncCalendar(calendarID string) error {
+	acc, err := accountForCalendar(calendarID)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range acc.Calendars {
+		if c.ID != calendarID {
+			continue
+		}
+
+		s, err := LoadStore(calendarID)
+		if err != nil {
+			return err
+		}
+		if err := s.Sync(acc, c); err != nil {
+			return err
+		}
+		return s.Save()
+	}
+
+	return nil
+}
+
+// cachedEvent returns the specified event from the store.
+func cachedEvent(calendarID, eventID string) (*Event, error) {
+	s, err := LoadStore(calendarID)
+	if err != nil {
+		return nil, err
+	}
+
+	e, ok := s.Events[eventID]
+	if !ok {
+		return nil, fmt.Errorf("event %q not found", eventID)
+	}
+
+	return e, nil
+}
+
+// updateCachedEvents calls fn on every stored event. If fn returns true,
+// the event has been changed and its store is saved.
+func updateCachedEvents(fn func(e *Event) bool) error {
+	names, err := storeNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		s := &Store{}
+		if err := wf.Cache.LoadJSON(name, s); err != nil {
+			return errors.Wrap(err, "load event store")
+		}
+
+		var changed bool
+		for _, e := range s.Events {
+			if fn(e) {
+				changed = true
+			}
+		}
+
+		if changed {
+			if err := s.Save(); err != nil {
+				return err
+			}
+			log.Printf("[store] updated %q", name)
+		}
+	}
+
+	return nil
+}
+
+// removeCachedEvent deletes the specified event from its store.
+func removeCachedEvent(calendarID, eventID string) error {
+	s, err := LoadStore(calendarID)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := s.Events[eventID]; !ok {
+		return nil
+	}
+
+	delete(s.Events, eventID)
+	return s.Save()
+}
+
+// storeNames returns the filenames of all cached stores.
+func storeNames() ([]string, error) {
+	infos, err := ioutil.ReadDir(wf.CacheDir())
+	if err != nil {
+		return nil, errors.Wrap(err, "read cache directory")
+	}
+
+	var names []string
+	for _, fi := range infos {
+		if isStoreFile(fi.Name()) {
+			names = append(names, fi.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// unsyncedEvents returns events in calendar cal between start and end from
+// the server. It is for periods outside the synced window, and results are
+// cached like stores.
+func unsyncedEvents(cal *Calendar, start, end time.Time) ([]*Event, error) {
+	acc, err := accountForCalendar(cal.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events []*Event
+		name   = unsyncedName(cal.ID, start, end)
+		reload = func() (interface{}, error) { return acc.Provider().Events(cal, start, end) }
+	)
+
+	if err := wf.Cache.LoadOrStoreJSON(name, opts.MaxAgeEvents(), reload, &events); err != nil {
+		return nil, err
+	}
+
+	for _, e := range events {
+		if e.AllDay {
+			e.Start, e.End = inDisplayTZ(e.Start), inDisplayTZ(e.End)
+		}
+	}
+
+	return events, nil
+}
+
+// unsyncedName returns the cache filename of events fetched by unsyncedEvents.
+func unsyncedName(calendarID string, start, end time.Time) string {
+	key := calendarID + "|" + start.Format(time.RFC3339) + "|" + end.Format(time.RFC3339)
+	return fmt.Sprintf("unsynced-%x.json", sha1.Sum([]byte(key)))
+}
+
+// isUnsyncedFile returns true if name is the filename of events cached by
+// unsyncedEvents.
+func isUnsyncedFile(name string) bool {
+	return strings.HasPrefix(name, "unsynced-") && strings.HasSuffix(name, ".json")
+}
+
+// isStoreFile returns true if name is the filename of a Store.
+func isStoreFile(name string) bool {
+	return strings.HasPrefix(name, "store-") && strings.HasSuffix(name, ".json")
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSyncProvider is an in-memory syncProvider.
+type fakeSyncProvider struct {
+	events  []*Event // returned by SyncEvents
+	changed []*Event // returned by SyncChanges
+	deleted []string // returned by SyncChanges
+	expired bool     // whether SyncChanges returns errSyncTokenExpired
+	token   string   // returned by SyncEvents and SyncChanges
+
+	fullSyncs int
+	syncs     int
+}
+
+func (p *fakeSyncProvider) Calendars() ([]*Calendar, error) { return nil, nil }
+func (p *fakeSyncProvider) Events(cal *Calendar, start, end time.Time) ([]*Event, error) {
+	return p.events, nil
+}
+func (p *fakeSyncProvider) CreateEvent(cal *Calendar, spec *EventSpec) error        { return nil }
+func (p *fakeSyncProvider) UpdateEvent(cal *Calendar, e *Event, field string) error { return nil }
+func (p *fakeSyncProvider) DeleteEvent(cal *Calendar, id string) error              { return nil }
+func (p *fakeSyncProvider) ImportEvent(cal *Calendar, vc *icalComponent) error      { return nil }
+
+func (p *fakeSyncProvider) SyncEvents(cal *Calendar, start, end time.Time) ([]*Event, string, error) {
+	p.fullSyncs++
+	return p.events, p.token, nil
+}
+
+func (p *fakeSyncProvider) SyncChanges(cal *Calendar, token string) ([]*Event, []string, string, error) {
+	p.syncs++
+	if p.expired {
+		return nil, nil, "", errSyncTokenExpired
+	}
+	return p.changed, p.deleted, p.token, nil
+}
+
+// testEvent returns an hour-long event starting at start.
+func testEvent(id string, start time.Time) *Event {
+	return &Event{ID: id, Title: id, Start: start, End: start.Add(time.Hour)}
+}
+
+// Sync must keep the sync token, so the next sync is incremental.
+func TestStoreSyncToken(t *testing.T) {
+	var (
+		cal = &Calendar{ID: "cal", Title: "Calendar"}
+		now = time.Now()
+		p   = &fakeSyncProvider{events: []*Event{testEvent("a", now)}, token: "t1"}
+		s   = &Store{CalendarID: cal.ID, Events: map[string]*Event{}}
+	)
+
+	if err := s.sync(p, cal); err != nil {
+		t.Fatal(err)
+	}
+	if s.SyncToken != "t1" {
+		t.Errorf("Bad token after full sync. Expected=%q, Got=%q", "t1", s.SyncToken)
+	}
+
+	p.token = "t2"
+	if err := s.sync(p, cal); err != nil {
+		t.Fatal(err)
+	}
+	if p.fullSyncs != 1 || p.syncs != 1 {
+		t.Errorf("Second sync not incremental. fullSyncs=%d, syncs=%d", p.fullSyncs, p.syncs)
+	}
+	if s.SyncToken != "t2" {
+		t.Errorf("Bad token after incremental sync. Expected=%q, Got=%q", "t2", s.SyncToken)
+	}
+}
+
+func TestStoreSync(t *testing.T) {
+	var (
+		cal = &Calendar{ID: "cal", Title: "Calendar"}
+		now = time.Now()
+		a   = testEvent("a", now)
+		b   = testEvent("b", now.Add(time.Hour))
+		c   = testEvent("c", now.Add(2*time.Hour))
+	)
+
+	ids := func(s *Store) string {
+		var l []string
+		for id := range s.Events {
+			l = append(l, id)
+		}
+		sort.Strings(l)
+		return strings.Join(l, ",")
+	}
+
+	// full sync of an empty store
+	p := &fakeSyncProvider{events: []*Event{a, b}, token: "t1"}
+	s := &Store{CalendarID: cal.ID, Events: map[string]*Event{}}
+	if err := s.sync(p, cal); err != nil {
+		t.Fatal(err)
+	}
+	if p.fullSyncs != 1 || ids(s) != "a,b" {
+		t.Fatalf("Bad full sync. fullSyncs=%d, events=%q", p.fullSyncs, ids(s))
+	}
+	today := midnight(now)
+	if !s.Start.Equal(today.AddDate(0, 0, -storePastDays)) || !s.End.Equal(today.AddDate(0, 0, storeFutureDays)) {
+		t.Errorf("Bad window: %s - %s", s.Start, s.End)
+	}
+	if s.Truncated {
+		t.Error("Store truncated")
+	}
+
+	// changes are merged and deleted events removed
+	renamed := testEvent("a", now)
+	renamed.Title = "renamed"
+	p.changed, p.deleted, p.token = []*Event{renamed, c}, []string{"b", "x"}, "t2"
+	if err := s.sync(p, cal); err != nil {
+		t.Fatal(err)
+	}
+	if p.fullSyncs != 1 || p.syncs != 1 {
+		t.Fatalf("Sync not incremental. fullSyncs=%d, syncs=%d", p.fullSyncs, p.syncs)
+	}
+	if ids(s) != "a,c" || s.Events["a"].Title != "renamed" {
+		t.Errorf("Bad incremental sync. events=%q, title=%q", ids(s), s.Events["a"].Title)
+	}
+	if s.SyncToken != "t2" {
+		t.Errorf("Bad token. Expected=%q, Got=%q", "t2", s.SyncToken)
+	}
+
+	// expired token falls back to a full sync
+	p.expired, p.token = true, "t3"
+	if err := s.sync(p, cal); err != nil {
+		t.Fatal(err)
+	}
+	if p.fullSyncs != 2 || p.syncs != 2 || ids(s) != "a,b" || s.SyncToken != "t3" {
+		t.Errorf("Bad sync after expired token. fullSyncs=%d, syncs=%d, events=%q, token=%q",
+			p.fullSyncs, p.syncs, ids(s), s.SyncToken)
+	}
+
+	// old window is moved by a full sync
+	p.expired = false
+	s.FullSync = now.Add(-fullSyncInterval - time.Hour)
+	s.Start, s.End = s.Start.AddDate(0, 0, -10), s.End.AddDate(0, 0, -10)
+	if err := s.sync(p, cal); err != nil {
+		t.Fatal(err)
+	}
+	if p.fullSyncs != 3 || p.syncs != 2 {
+		t.Errorf("Old store not fully synced. fullSyncs=%d, syncs=%d", p.fullSyncs, p.syncs)
+	}
+	if !s.Start.Equal(today.AddDate(0, 0, -storePastDays)) || time.Since(s.FullSync) > time.Minute {
+		t.Errorf("Window not moved: start=%s, fullSync=%s", s.Start, s.FullSync)
+	}
+
+	// full sync that hits the limit is truncated
+	defer func(n int) { opts.MaxResults = n }(opts.MaxResults)
+	opts.MaxResults = 2
+	s.SyncToken = ""
+	if err := s.sync(p, cal); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Truncated {
+		t.Error("Store not truncated")
+	}
+}
+
+func TestStoreBetween(t *testing.T) {
+	var (
+		start = time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)
+		s     = &Store{Events: map[string]*Event{"e": testEvent("e", start)}} // 10:00-11:00
+	)
+
+	tests := []struct {
+		start, end string
+		match      bool
+	}{
+		{"09:00", "10:00", false}, // ends as event starts
+		{"11:00", "12:00", false}, // starts as event ends
+		{"09:00", "10:01", true},
+		{"10:59", "12:00", true},
+		{"10:15", "10:45", true}, // inside event
+		{"09:00", "12:00", true}, // contains event
+		{"10:00", "11:00", true}, // same as event
+		{"08:00", "09:00", false},
+	}
+
+	at := func(s string) time.Time {
+		c, err := time.Parse("15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2019, 6, 1, c.Hour(), c.Minute(), 0, 0, time.UTC)
+	}
+
+	for _, td := range tests {
+		td := td
+		t.Run(td.start+"-"+td.end, func(t *testing.T) {
+			n := len(s.Between(at(td.start), at(td.end)))
+			if (n == 1) != td.match {
+				t.Errorf("Expected match=%v, Got %d event(s)", td.match, n)
+			}
+		})
+	}
+}
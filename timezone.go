@@ -0,0 +1,331 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// Zone times are shown in and days start in. Set by DISPLAY_TZ.
+	displayTZ = time.Local
+	// Optional additional zone shown in event subtitles. Set by SECONDARY_TZ.
+	secondaryTZ *time.Location
+)
+
+// setTimeZones sets the display and secondary time zones from IANA names,
+// e.g. "Europe/Berlin". Empty names leave the zone unchanged.
+func setTimeZones(display, secondary string) error {
+	if display != "" {
+		loc, err := time.LoadLocation(display)
+		if err != nil {
+			return errors.Wrap(err, "load DISPLAY_TZ")
+		}
+
+		displayTZ = loc
+		today = midnight(time.Now())
+		tomorrow = today.AddDate(0, 0, 1)
+		yesterday = today.AddDate(0, 0, -1)
+	}
+
+	if secondary != "" {
+		loc, err := time.LoadLocation(secondary)
+		if err != nil {
+			return errors.Wrap(err, "load SECONDARY_TZ")
+		}
+		secondaryTZ = loc
+	}
+
+	log.Printf("[timezone] display=%v, secondary=%v", displayTZ, secondaryTZ)
+
+	return nil
+}
+
+// inDisplayTZ returns all-day dates anchored at midnight in the display zone.
+// All-day events are floating and happen on the same date everywhere, so
+// their stored times are re-anchored in case the display zone has changed.
+func inDisplayTZ(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, displayTZ)
+}
+
+// otherZoneTimes returns the start time of a timed event in the secondary
+// zone and in the zone the event was created in, e.g. " (15:00 CET)".
+// Zones with the same offset as the display zone are omitted.
+func otherZoneTimes(e *Event) string {
+	if e.AllDay {
+		return ""
+	}
+
+	var (
+		_, off = e.Start.In(displayTZ).Zone()
+		seen   = map[int]bool{off: true}
+		zones  = []*time.Location{secondaryTZ}
+		times  []string
+	)
+
+	if e.TimeZone != "" {
+		if loc, err := loadZone(e.TimeZone); err == nil {
+			zones = append(zones, loc)
+		} else {
+			log.Printf("[timezone] ERR: load event zone %q: %v", e.TimeZone, err)
+		}
+	}
+
+	for _, loc := range zones {
+		if loc == nil {
+			continue
+		}
+
+		t := e.Start.In(loc)
+		if _, off := t.Zone(); !seen[off] {
+			seen[off] = true
+			times = append(times, t.Format(hourFormat+" MST"))
+		}
+	}
+
+	if len(times) == 0 {
+		return ""
+	}
+
+	return " (" + strings.Join(times, ", ") + ")"
+}
+
+// windowsZones maps the Windows zone names used by Outlook and Exchange to
+// IANA zones (from CLDR's windowsZones.xml).
+var windowsZones = map[string]string{
+	"Dateline Standard Time":          "Etc/GMT+12",
+	"UTC-11":                          "Etc/GMT+11",
+	"Hawaiian Standard Time":          "Pacific/Honolulu",
+	"Alaskan Standard Time":           "America/Anchorage",
+	"Pacific Standard Time":           "America/Los_Angeles",
+	"Pacific Standard Time (Mexico)":  "America/Tijuana",
+	"US Mountain Standard Time":       "America/Phoenix",
+	"Mountain Standard Time":          "America/Denver",
+	"Central America Standard Time":   "America/Guatemala",
+	"Central Standard Time":           "America/Chicago",
+	"Central Standard Time (Mexico)":  "America/Mexico_City",
+	"Canada Central Standard Time":    "America/Regina",
+	"SA Pacific Standard Time":        "America/Bogota",
+	"Eastern Standard Time":           "America/New_York",
+	"US Eastern Standard Time":        "America/Indianapolis",
+	"Venezuela Standard Time":         "America/Caracas",
+	"Atlantic Standard Time":          "America/Halifax",
+	"SA Western Standard Time":        "America/La_Paz",
+	"Pacific SA Standard Time":        "America/Santiago",
+	"Newfoundland Standard Time":      "America/St_Johns",
+	"E. South America Standard Time":  "America/Sao_Paulo",
+	"Argentina Standard Time":         "America/Buenos_Aires",
+	"SA Eastern Standard Time":        "America/Cayenne",
+	"Greenland Standard Time":         "America/Godthab",
+	"UTC-02":                          "Etc/GMT+2",
+	"Azores Standard Time":            "Atlantic/Azores",
+	"Cape Verde Standard Time":        "Atlantic/Cape_Verde",
+	"UTC":                             "Etc/UTC",
+	"GMT Standard Time":               "Europe/London",
+	"Greenwich Standard Time":         "Atlantic/Reykjavik",
+	"Morocco Standard Time":           "Africa/Casablanca",
+	"W. Europe Standard Time":         "Europe/Berlin",
+	"Central Europe Standard Time":    "Europe/Budapest",
+	"Romance Standard Time":           "Europe/Paris",
+	"Central European Standard Time":  "Europe/Warsaw",
+	"W. Central Africa Standard Time": "Africa/Lagos",
+	"GTB Standard Time":               "Europe/Bucharest",
+	"E. Europe Standard Time":         "Europe/Chisinau",
+	"FLE Standard Time":               "Europe/Kiev",
+	"Egypt Standard Time":             "Africa/Cairo",
+	"South Africa Standard Time":      "Africa/Johannesburg",
+	"Israel Standard Time":            "Asia/Jerusalem",
+	"Turkey Standard Time":            "Europe/Istanbul",
+	"Arabic Standard Time":            "Asia/Baghdad",
+	"Arab Standard Time":              "Asia/Riyadh",
+	"Russian Standard Time":           "Europe/Moscow",
+	"E. Africa Standard Time":         "Africa/Nairobi",
+	"Iran Standard Time":              "Asia/Tehran",
+	"Arabian Standard Time":           "Asia/Dubai",
+	"Afghanistan Standard Time":       "Asia/Kabul",
+	"West Asia Standard Time":         "Asia/Tashkent",
+	"Pakistan Standard Time":          "Asia/Karachi",
+	"India Standard Time":             "Asia/Calcutta",
+	"Sri Lanka Standard Time":         "Asia/Colombo",
+	"Nepal Standard Time":             "Asia/Katmandu",
+	"Central Asia Standard Time":      "Asia/Almaty",
+	"Bangladesh Standard Time":        "Asia/Dhaka",
+	"Myanmar Standard Time":           "Asia/Rangoon",
+	"SE Asia Standard Time":           "Asia/Bangkok",
+	"China Standard Time":             "Asia/Shanghai",
+	"Singapore Standard Time":         "Asia/Singapore",
+	"Taipei Standard Time":            "Asia/Taipei",
+	"W. Australia Standard Time":      "Australia/Perth",
+	"Korea Standard Time":             "Asia/Seoul",
+	"Tokyo Standard Time":             "Asia/Tokyo",
+	"Cen. Australia Standard Time":    "Australia/Adelaide",
+	"AUS Central Standard Time":       "Australia/Darwin",
+	"E. Australia Standard Time":      "Australia/Brisbane",
+	"AUS Eastern Standard Time":       "Australia/Sydney",
+	"Tasmania Standard Time":          "Australia/Hobart",
+	"West Pacific Standard Time":      "Pacific/Port_Moresby",
+	"Central Pacific Standard Time":   "Pacific/Guadalcanal",
+	"New Zealand Standard Time":       "Pacific/Auckland",
+	"UTC+12":                          "Etc/GMT-12",
+	"Tonga Standard Time":             "Pacific/Tongatapu",
+}
+
+// loadZone returns the zone with the given IANA or Windows name.
+func loadZone(name string) (*time.Location, error) {
+	name = strings.Trim(name, "/")
+	if name == "" || name == "Local" {
+		return nil, errors.New("no zone name")
+	}
+	if iana, ok := windowsZones[name]; ok {
+		name = iana
+	}
+	return time.LoadLocation(name)
+}
+
+// icalZoneProps are the properties of a VEVENT that may have a TZID.
+var icalZoneProps = []string{"DTSTART", "DTEND", "RECURRENCE-ID", "RDATE", "EXDATE"}
+
+// resolveZones makes sure the TZIDs of the events in an iCalendar object
+// can be loaded. Windows names are replaced with IANA ones, and times in
+// other zones are converted to UTC using the offsets in the zone's
+// VTIMEZONE. It returns an error if a zone has no VTIMEZONE.
+//
+// Go can't create zones from VTIMEZONE rules, so repeating events in
+// such zones keep the same UTC time across changes to daylight saving time.
+func resolveZones(root *icalComponent) error {
+	zones := map[string]*icalComponent{}
+	for _, tz := range root.Children("VTIMEZONE") {
+		zones[tz.Text("TZID")] = tz
+	}
+
+	for _, v := range root.Children("VEVENT") {
+		for _, name := range icalZoneProps {
+			for _, p := range v.PropsNamed(name) {
+				tzid := p.Param("TZID")
+				if tzid == "" {
+					continue
+				}
+
+				if loc, err := loadZone(tzid); err == nil {
+					p.Params["TZID"] = loc.String()
+					continue
+				}
+
+				tz, ok := zones[tzid]
+				if !ok {
+					return fmt.Errorf("unknown time zone %q", tzid)
+				}
+
+				var values []string
+				for _, s := range strings.Split(p.Value, ",") {
+					t, err := time.Parse(icalDateTime, s)
+					if err != nil {
+						return errors.Wrapf(err, "parse %s", p.Name)
+					}
+					offset, err := vtimezoneOffset(tz, t)
+					if err != nil {
+						return errors.Wrapf(err, "time zone %q", tzid)
+					}
+					values = append(values, t.Add(-time.Duration(offset)*time.Second).Format(icalUTC))
+				}
+
+				delete(p.Params, "TZID")
+				p.Value = strings.Join(values, ",")
+			}
+		}
+	}
+
+	return nil
+}
+
+// vtimezoneOffset returns the UTC offset in seconds of VTIMEZONE tz at
+// local time t (whose zone is ignored).
+func vtimezoneOffset(tz *icalComponent, t time.Time) (int, error) {
+	var (
+		latest time.Time // onset of observance in effect at t
+		offset int
+		first  time.Time // onset of first observance
+		before int       // offset before first observance
+	)
+
+	for _, c := range tz.Components {
+		if c.Name != "STANDARD" && c.Name != "DAYLIGHT" {
+			continue
+		}
+
+		to, err := parseICalOffset(c.Text("TZOFFSETTO"))
+		if err != nil {
+			return 0, errors.Wrap(err, "parse TZOFFSETTO")
+		}
+		from, err := parseICalOffset(c.Text("TZOFFSETFROM"))
+		if err != nil {
+			from = to
+		}
+
+		start, err := time.Parse(icalDateTime, c.Text("DTSTART"))
+		if err != nil {
+			return 0, errors.Wrap(err, "parse observance DTSTART")
+		}
+		if first.IsZero() || start.Before(first) {
+			first, before = start, from
+		}
+
+		onsets := []time.Time{start}
+		if p := c.Prop("RRULE"); p != nil {
+			r, err := parseRRule(p.Value, time.UTC)
+			if err != nil {
+				return 0, errors.Wrap(err, "parse observance RRULE")
+			}
+			onsets = r.Between(start, t.Add(time.Second))
+		}
+		for _, p := range c.PropsNamed("RDATE") {
+			onsets = append(onsets, icalTimes(p, time.UTC)...)
+		}
+
+		for _, o := range onsets {
+			if !o.After(t) && (latest.IsZero() || o.After(latest)) {
+				latest, offset = o, to
+			}
+		}
+	}
+
+	if first.IsZero() {
+		return 0, errors.New("no observances")
+	}
+	if latest.IsZero() {
+		return before, nil
+	}
+	return offset, nil
+}
+
+// parseICalOffset parses a UTC offset, e.g. "+0100", into seconds.
+func parseICalOffset(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if len(s) != 5 && len(s) != 7 || (s[0] != '+' && s[0] != '-') {
+		return 0, fmt.Errorf("invalid UTC offset: %q", s)
+	}
+
+	var secs int
+	for i, unit := range []int{3600, 60, 1} {
+		if 1+2*i >= len(s) {
+			break
+		}
+		n, err := strconv.Atoi(s[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid UTC offset: %q", s)
+		}
+		secs += n * unit
+	}
+
+	if s[0] == '-' {
+		secs = -secs
+	}
+	return secs, nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2019 Dean Jackson <deanishe@deanishe.net>
+// MIT Licence applies http://opensource.org/licenses/MIT
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeZones(t *testing.T) {
+	defer func(display, secondary *time.Location, d time.Time) {
+		displayTZ, secondaryTZ = display, secondary
+		today, tomorrow, yesterday = d, d.AddDate(0, 0, 1), d.AddDate(0, 0, -1)
+	}(displayTZ, secondaryTZ, today)
+
+	if err := setTimeZones("Europe/London", "Europe/Berlin"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2019, 1, 14, 14, 0, 0, 0, time.UTC)
+	e := &Event{Start: start, End: start.Add(time.Hour), TimeZone: "America/New_York"}
+
+	if x, v := " (15:00 CET, 09:00 EST)", otherZoneTimes(e); v != x {
+		t.Errorf("Bad zone times. Expected=%q, Got=%q", x, v)
+	}
+
+	// zones with the same offset as the display zone are omitted
+	e.TimeZone = "Europe/Lisbon"
+	if x, v := " (15:00 CET)", otherZoneTimes(e); v != x {
+		t.Errorf("Bad zone times. Expected=%q, Got=%q", x, v)
+	}
+
+	// days are bucketed in the display zone
+	if err := setTimeZones("Asia/Tokyo", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	late := &Event{Start: time.Date(2019, 1, 14, 20, 0, 0, 0, time.UTC)}
+	late.End = late.Start.Add(time.Hour)
+
+	days := groupByDay([]*Event{late}, time.Date(2019, 1, 14, 0, 0, 0, 0, displayTZ),
+		time.Date(2019, 1, 17, 0, 0, 0, 0, displayTZ))
+	if len(days) != 1 {
+		t.Fatalf("Expected 1 day, got %d", len(days))
+	}
+	if x, v := "2019-01-15", days[0].Date.Format(timeFormat); v != x {
+		t.Errorf("Bad day. Expected=%s, Got=%s", x, v)
+	}
+}
+
+func TestResolveZones(t *testing.T) {
+	const ics = "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VTIMEZONE\r\n" +
+		"TZID:Customized Time Zone\r\n" +
+		"BEGIN:STANDARD\r\n" +
+		"DTSTART:16011028T030000\r\n" +
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=10\r\n" +
+		"TZOFFSETFROM:+0200\r\n" +
+		"TZOFFSETTO:+0100\r\n" +
+		"END:STANDARD\r\n" +
+		"BEGIN:DAYLIGHT\r\n" +
+		"DTSTART:16010325T020000\r\n" +
+		"RRULE:FREQ=YEARLY;BYDAY=-1SU;BYMONTH=3\r\n" +
+		"TZOFFSETFROM:+0100\r\n" +
+		"TZOFFSETTO:+0200\r\n" +
+		"END:DAYLIGHT\r\n" +
+		"END:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:a\r\n" +
+		"DTSTART;TZID=W. Europe Standard Time:20190403T100000\r\n" +
+		"DTEND;TZID=Customized Time Zone:20190403T110000\r\n" +
+		"EXDATE;TZID=Customized Time Zone:20190102T100000,20190403T100000\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	root, err := parseICal(strings.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveZones(root); err != nil {
+		t.Fatal(err)
+	}
+
+	v := root.Children("VEVENT")[0]
+	for name, x := range map[string]string{
+		"DTSTART": "DTSTART;TZID=Europe/Berlin:20190403T100000",
+		"DTEND":   "DTEND:20190403T090000Z",
+		"EXDATE":  "EXDATE:20190102T090000Z,20190403T080000Z",
+	} {
+		if s := v.Prop(name).String(); s != x {
+			t.Errorf("Bad %s. Expected=%q, Got=%q", name, x, s)
+		}
+	}
+
+	// zones without a VTIMEZONE are an error
+	root, err = parseICal(strings.NewReader(strings.Replace(ics, "TZID:Customized", "TZID:Other", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolveZones(root); err == nil {
+		t.Error("Accepted unknown zone")
+	}
+}